@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/domoritz/summarization-go/summarize"
+)
+
+var addr = flag.String("addr", ":8080", "address to listen on")
+var timeout = flag.Duration("timeout", 30*time.Second, "how long a request may take, summaries are canceled after it")
+var shutdownTimeout = flag.Duration("shutdown", 10*time.Second, "how long requests may take to finish when the server shuts down")
+var workers = flag.Int("workers", 1, "goroutines that build indexes from CSV files")
+var negationMin = flag.Float64("negationmin", 0.3, "share of the tuples with a value that a value needs to be negated, 0 disables negations")
+
+// largest request body that is read
+const maxBodySize = 1 << 20
+
+// status of requests whose client went away before the answer, as in nginx
+const statusClientClosedRequest = 499
+
+// indexFlags collects name=path pairs
+type indexFlags []string
+
+func (f *indexFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *indexFlags) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return errors.New("Expected name=path.")
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// index is a named index that requests can summarize
+type index struct {
+	name     string
+	relation *summarize.RelationIndex
+	lock     chan struct{} // held while the index is summarized, summaries cover tuples of the index
+}
+
+// acquire waits until the index is free or the context is done
+func (ix *index) acquire(ctx context.Context) error {
+	select {
+	case ix.lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release resets what a summary covered and frees the index
+func (ix *index) release() {
+	ix.relation.Reset()
+	<-ix.lock
+}
+
+type server struct {
+	indexes map[string]*index
+}
+
+func main() {
+	var paths indexFlags
+	flag.Var(&paths, "index", "load an index as name=path, from a snapshot or from a CSV file with types and names in the first two lines (repeatable)")
+	flag.Parse()
+
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "At least one index is required.")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	s := server{make(map[string]*index)}
+	for _, p := range paths {
+		parts := strings.SplitN(p, "=", 2)
+		start := time.Now()
+		relation, err := loadIndex(parts[1])
+		if err != nil {
+			log.Fatalf("Loading index %s from %s: %s\n", parts[0], parts[1], err)
+		}
+		if *negationMin > 0 {
+			relation.AddNegations(*negationMin)
+		}
+		s.indexes[parts[0]] = &index{parts[0], relation, make(chan struct{}, 1)}
+		log.Printf("Loaded index %s with %d tuples in %s\n", parts[0], relation.NumTuples(), time.Since(start))
+	}
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      *timeout + 10*time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s\n", *addr)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// handler routes the requests of the server
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/indexes", s.handleIndexes)
+	mux.HandleFunc("/indexes/", s.handleIndex)
+	return mux
+}
+
+// loadIndex reads a snapshot or builds an index from a CSV file
+func loadIndex(path string) (*summarize.RelationIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		return summarize.NewIndexFromReader(f, summarize.MakeEqualWeightAssessor(), *workers)
+	}
+	return summarize.ReadIndex(f)
+}
+
+type attributeSchema struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type schema struct {
+	Name       string            `json:"name"`
+	Tuples     int               `json:"tuples"`
+	Attributes []attributeSchema `json:"attributes"`
+}
+
+type summarizeRequest struct {
+	Size          int  `json:"size"`
+	Negations     int  `json:"negations"`
+	Disjuncts     int  `json:"disjuncts"`
+	Deterministic bool `json:"deterministic"`
+}
+
+type membersRequest struct {
+	Formula []summarize.Value `json:"formula"`
+}
+
+type membersResponse struct {
+	Tuples []int `json:"tuples"`
+}
+
+func (ix *index) schema() schema {
+	attrs := *ix.relation.Attrs()
+	attributes := make([]attributeSchema, len(attrs))
+	for i := range attrs {
+		attributes[i] = attributeSchema{attrs[i].Name(), attrs[i].Type().String()}
+	}
+	return schema{ix.name, ix.relation.NumTuples(), attributes}
+}
+
+// handleIndexes lists the schemas of all indexes
+func (s *server) handleIndexes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET is allowed.")
+		return
+	}
+
+	names := make([]string, 0, len(s.indexes))
+	for name := range s.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	schemas := make([]schema, len(names))
+	for i, name := range names {
+		schemas[i] = s.indexes[name].schema()
+	}
+	writeJSON(w, http.StatusOK, schemas)
+}
+
+// handleIndex serves /indexes/{name}, /indexes/{name}/summarize and /indexes/{name}/members
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/indexes/"), "/"), "/")
+	ix, has := s.indexes[parts[0]]
+	if !has || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown index %s.", parts[0]))
+		return
+	}
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "Only GET is allowed.")
+			return
+		}
+		writeJSON(w, http.StatusOK, ix.schema())
+	case "summarize":
+		s.handleSummarize(w, r, ix)
+	case "members":
+		s.handleMembers(w, r, ix)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown action %s.", action))
+	}
+}
+
+func (s *server) handleSummarize(w http.ResponseWriter, r *http.Request, ix *index) {
+	request := summarizeRequest{Size: 10, Disjuncts: 1}
+	if !readRequest(w, r, &request) {
+		return
+	}
+	if request.Size < 1 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid summary size %d.", request.Size))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), *timeout)
+	defer cancel()
+	if err := ix.acquire(ctx); err != nil {
+		writeContextError(w, err)
+		return
+	}
+	defer ix.release()
+
+	options := summarize.DefaultOptions
+	options.MaxNegations = request.Negations
+	options.MaxDisjuncts = request.Disjuncts
+	options.Deterministic = request.Deterministic
+
+	start := time.Now()
+	result, err := ix.relation.SummarizeContext(ctx, request.Size, options)
+	if err != nil {
+		writeContextError(w, err)
+		return
+	}
+	log.Printf("Summarized %s in %s\n", ix.name, time.Since(start))
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *server) handleMembers(w http.ResponseWriter, r *http.Request, ix *index) {
+	var request membersRequest
+	if !readRequest(w, r, &request) {
+		return
+	}
+
+	// members only reads the tuples of the index, not what a summary covered, so they do not wait for summaries
+	tuples := ix.relation.Members(request.Formula)
+	if tuples == nil {
+		tuples = []int{}
+	}
+	writeJSON(w, http.StatusOK, membersResponse{tuples})
+}
+
+// readRequest decodes the JSON body of a POST request and writes an error if it cannot
+func readRequest(w http.ResponseWriter, r *http.Request, request interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST is allowed.")
+		return false
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request: %s", err))
+		return false
+	}
+	return true
+}
+
+func writeContextError(w http.ResponseWriter, err error) {
+	if err == context.DeadlineExceeded {
+		writeError(w, http.StatusServiceUnavailable, "The request timed out.")
+		return
+	}
+	// the client is gone and will not read this, the status is only for logs
+	writeError(w, statusClientClosedRequest, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/domoritz/summarization-go/summarize"
+)
+
+func testServer(t *testing.T) *server {
+	relation, err := summarize.NewIndexFromString("single,single\nvenue,year\nSIGMOD,2015\nSIGMOD,2014\nVLDB,2015\nICDE,2015", summarize.MakeEqualWeightAssessor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &server{map[string]*index{"papers": {"papers", relation, make(chan struct{}, 1)}}}
+}
+
+func serve(s *server, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, r)
+	return w
+}
+
+func TestRoutes(t *testing.T) {
+	s := testServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		answer string
+	}{
+		{"GET", "/indexes", "", http.StatusOK, `"name":"papers"`},
+		{"GET", "/indexes/papers", "", http.StatusOK, `"tuples":4`},
+		{"POST", "/indexes/papers/summarize", `{"size": 1}`, http.StatusOK, `"Summary":[[`},
+		{"POST", "/indexes/papers/members", `{"formula": [{"attribute": "venue", "value": "SIGMOD"}]}`, http.StatusOK, `{"tuples":[0,1]}`},
+		{"POST", "/indexes/papers/members", `{"formula": [{"attribute": "venue", "value": "PODS"}]}`, http.StatusOK, `{"tuples":[]}`},
+		{"POST", "/indexes", "", http.StatusMethodNotAllowed, "Only GET"},
+		{"POST", "/indexes/papers", "", http.StatusMethodNotAllowed, "Only GET"},
+		{"GET", "/indexes/papers/summarize", "", http.StatusMethodNotAllowed, "Only POST"},
+		{"GET", "/indexes/papers/members", "", http.StatusMethodNotAllowed, "Only POST"},
+		{"POST", "/indexes/papers/summarize", `{"size": 0}`, http.StatusBadRequest, "Invalid summary size"},
+		{"POST", "/indexes/papers/summarize", `{"size": `, http.StatusBadRequest, "Invalid request"},
+		{"POST", "/indexes/papers/summarize", `{"limit": 3}`, http.StatusBadRequest, "Invalid request"},
+		{"GET", "/indexes/books", "", http.StatusNotFound, "Unknown index books"},
+		{"GET", "/indexes/papers/formulas", "", http.StatusNotFound, "Unknown action formulas"},
+		{"GET", "/indexes/papers/summarize/all", "", http.StatusNotFound, "Unknown index"},
+	}
+	for _, test := range tests {
+		w := serve(s, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.answer) {
+			t.Error("Wrong answer", test.method, test.path, test.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMembersDuringSummary(t *testing.T) {
+	s := testServer(t)
+
+	// a summary holds the index, members do not wait for it
+	s.indexes["papers"].lock <- struct{}{}
+	r := httptest.NewRequest("POST", "/indexes/papers/members", strings.NewReader(`{"formula": [{"attribute": "year", "value": "2015"}]}`))
+	if w := serve(s, r); w.Code != http.StatusOK || w.Body.String() != "{\"tuples\":[0,2,3]}\n" {
+		t.Error("Members should not wait for summaries", w.Code, w.Body.String())
+	}
+	if len(s.indexes["papers"].lock) != 1 {
+		t.Error("Members should not free the index")
+	}
+}
+
+func TestSummarizeCanceled(t *testing.T) {
+	s := testServer(t)
+	defer func(d time.Duration) { *timeout = d }(*timeout)
+
+	// the summary times out while it waits for another summary
+	*timeout = time.Millisecond
+	s.indexes["papers"].lock <- struct{}{}
+	r := httptest.NewRequest("POST", "/indexes/papers/summarize", strings.NewReader(`{"size": 1}`))
+	if w := serve(s, r); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "timed out") {
+		t.Error("Summary should time out", w.Code, w.Body.String())
+	}
+	<-s.indexes["papers"].lock
+
+	// the summary is canceled before it finds a formula
+	*timeout = time.Nanosecond
+	r = httptest.NewRequest("POST", "/indexes/papers/summarize", strings.NewReader(`{"size": 1}`))
+	if w := serve(s, r); w.Code != http.StatusServiceUnavailable {
+		t.Error("Summary should time out", w.Code, w.Body.String())
+	}
+	if len(s.indexes["papers"].lock) != 0 {
+		t.Error("Canceled summaries should free the index")
+	}
+
+	// the client goes away
+	*timeout = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = httptest.NewRequest("POST", "/indexes/papers/summarize", strings.NewReader(`{"size": 1}`)).WithContext(ctx)
+	if w := serve(s, r); w.Code != statusClientClosedRequest {
+		t.Error("Canceled summaries should not look like an unavailable server", w.Code, w.Body.String())
+	}
+}
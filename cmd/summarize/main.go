@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/domoritz/summarization-go/summarize"
+)
+
+// exit codes
+const (
+	exitOK    = 0
+	exitError = 1 // the input could not be read or summarized
+	exitUsage = 2 // invalid flags or configuration, like the flag package
+)
+
+// longest JSON line that is read
+const maxLineLength = 16 * 1024 * 1024
+
+// config is the schema and how the input is summarized, flags override the values from a config file
+type config struct {
+	Format        string    `json:"format"`        // csv, tsv or jsonl
+	Header        bool      `json:"header"`        // whether the first csv or tsv row has the attribute names
+	Types         []string  `json:"types"`         // attribute types
+	Names         []string  `json:"names"`         // attribute names
+	Weights       []float64 `json:"weights"`       // attribute weights
+	Separator     string    `json:"separator"`     // separates the values of sets and the levels of hierarchies
+	WeightFunc    string    `json:"weightfunc"`    // equal, exponential, linear or attribute
+	Size          int       `json:"size"`          // number of formulas
+	Negations     int       `json:"negations"`     // negated cells per formula
+	NegationMin   float64   `json:"negationmin"`   // share of the tuples that a value needs to be negated
+	Disjuncts     int       `json:"disjuncts"`     // values per disjunction
+	Workers       int       `json:"workers"`       // goroutines that build the index and evaluate cells
+	Output        string    `json:"output"`        // table, json or csv
+	Deterministic bool      `json:"deterministic"` // whether the same input always gives the same summary
+	DrillDown     int       `json:"drilldown"`     // levels of summaries of the tuples that satisfy each formula
+	Pin           []string  `json:"pin"`           // values like venue=SIGMOD or venue!=SIGMOD that every formula includes
+	Require       []string  `json:"require"`       // attributes that every formula has a value of
+	Overlap       float64   `json:"overlap"`       // share of the weight of a tuple that is left every time a formula covers it
+	Alternatives  int       `json:"alternatives"`  // next best formulas that are shown for each formula
+}
+
+var defaults = config{"", true, nil, nil, nil, " ", "equal", 10, 0, 0.3, 1, 1, "table", false, 0, nil, nil, 0, 0}
+
+var configPath = flag.String("config", "", "read the configuration from this JSON file, flags override it")
+var format = flag.String("format", defaults.Format, "input format: csv, tsv or jsonl (default from the file extension, csv for stdin)")
+var header = flag.Bool("header", defaults.Header, "the first csv or tsv row has the attribute names")
+var types = flag.String("types", "", "comma separated attribute types: single, set, hierarchy, time, time:layout, time:hours or time:hours:layout (default single)")
+var names = flag.String("names", "", "comma separated attribute names (default from the header or the JSON keys)")
+var weights = flag.String("weights", "", "comma separated attribute weights (default 1)")
+var separator = flag.String("separator", defaults.Separator, "separates the values of sets and the levels of hierarchies")
+var weightFunc = flag.String("weightfunc", defaults.WeightFunc, "weight function: equal, exponential, linear or attribute")
+var size = flag.Int("size", defaults.Size, "number of formulas")
+var negations = flag.Int("negations", defaults.Negations, "negated values per formula")
+var negationMin = flag.Float64("negationmin", defaults.NegationMin, "share of the tuples with a value that a value needs to be negated")
+var disjuncts = flag.Int("disjuncts", defaults.Disjuncts, "values of a single attribute per disjunction")
+var workers = flag.Int("workers", defaults.Workers, "goroutines that build the index and evaluate cells")
+var output = flag.String("output", defaults.Output, "output format: table, json or csv")
+var outputPath = flag.String("o", "", "write the summary to this file instead of stdout")
+var deterministic = flag.Bool("deterministic", defaults.Deterministic, "always give the same summary for the same input")
+var pin = flag.String("pin", "", "comma separated values like venue=SIGMOD or venue!=SIGMOD that every formula includes")
+var require = flag.String("require", "", "comma separated attributes that every formula has a value of")
+var overlap = flag.Float64("overlap", defaults.Overlap, "share of the weight of a tuple that is left every time a formula covers it, 0 covers tuples once")
+var alternatives = flag.Int("alternatives", defaults.Alternatives, "also show this many of the next best formulas that the search considered for each formula")
+var drillDown = flag.Int("drilldown", defaults.DrillDown, "also summarize the tuples that satisfy each formula, this many levels deep")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [file]\n\nSummarizes a relation from a file or stdin.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	os.Exit(run())
+}
+
+func run() int {
+	if flag.NArg() > 1 {
+		flag.Usage()
+		return exitUsage
+	}
+	path := flag.Arg(0)
+
+	conf, err := loadConfig(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	input := io.Reader(os.Stdin)
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		input = f
+	}
+
+	fileNames, rows, err := readRows(input, conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if conf.Names == nil {
+		conf.Names = fileNames
+	}
+	if conf.Names == nil && len(rows) > 0 {
+		for i := range rows[0] {
+			conf.Names = append(conf.Names, fmt.Sprintf("attr%d", i+1))
+		}
+	}
+
+	assessor, err := checkSchema(&conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	relation, err := buildIndex(rows, conf, assessor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	options := summarize.DefaultOptions
+	options.MaxNegations = conf.Negations
+	options.MaxDisjuncts = conf.Disjuncts
+	options.Deterministic = conf.Deterministic
+	options.Workers = conf.Workers
+	options.Required = conf.Require
+	options.Overlap = conf.Overlap
+	options.Alternatives = conf.Alternatives
+	for _, p := range conf.Pin {
+		value, err := parseValue(p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		options.Pinned = append(options.Pinned, value)
+	}
+	if conf.Negations > 0 {
+		relation.AddNegations(conf.NegationMin)
+	}
+	tree := relation.DrillDown(conf.Size, conf.DrillDown, options)
+
+	out := io.Writer(os.Stdout)
+	if *outputPath != "" {
+		f, err := os.Create(*outputPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := writeResult(out, tree, conf.Output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// loadConfig combines the defaults, the config file and the flags that were set
+func loadConfig(path string) (config, error) {
+	conf := defaults
+	if *configPath != "" {
+		data, err := ioutil.ReadFile(*configPath)
+		if err != nil {
+			return conf, err
+		}
+		if err := json.Unmarshal(data, &conf); err != nil {
+			return conf, errors.New(fmt.Sprintf("Invalid config file %s: %s", *configPath, err))
+		}
+	}
+
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "format":
+			conf.Format = *format
+		case "header":
+			conf.Header = *header
+		case "types":
+			conf.Types = splitList(*types)
+		case "names":
+			conf.Names = splitList(*names)
+		case "weights":
+			conf.Weights = nil
+			for _, weight := range splitList(*weights) {
+				w, parseErr := strconv.ParseFloat(weight, 64)
+				if parseErr != nil {
+					err = errors.New(fmt.Sprintf("Invalid weight %s.", weight))
+				}
+				conf.Weights = append(conf.Weights, w)
+			}
+		case "separator":
+			conf.Separator = *separator
+		case "weightfunc":
+			conf.WeightFunc = *weightFunc
+		case "size":
+			conf.Size = *size
+		case "negations":
+			conf.Negations = *negations
+		case "negationmin":
+			conf.NegationMin = *negationMin
+		case "disjuncts":
+			conf.Disjuncts = *disjuncts
+		case "workers":
+			conf.Workers = *workers
+		case "output":
+			conf.Output = *output
+		case "deterministic":
+			conf.Deterministic = *deterministic
+		case "drilldown":
+			conf.DrillDown = *drillDown
+		case "pin":
+			conf.Pin = splitList(*pin)
+		case "require":
+			conf.Require = splitList(*require)
+		case "overlap":
+			conf.Overlap = *overlap
+		case "alternatives":
+			conf.Alternatives = *alternatives
+		}
+	})
+	if err != nil {
+		return conf, err
+	}
+
+	if conf.Format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".tsv", ".tab":
+			conf.Format = "tsv"
+		case ".jsonl", ".ndjson":
+			conf.Format = "jsonl"
+		default:
+			conf.Format = "csv"
+		}
+	}
+	switch conf.Format {
+	case "csv", "tsv", "jsonl":
+	default:
+		return conf, errors.New(fmt.Sprintf("Unknown input format %s.", conf.Format))
+	}
+	switch conf.Output {
+	case "table", "json", "csv":
+	default:
+		return conf, errors.New(fmt.Sprintf("Unknown output format %s.", conf.Output))
+	}
+	if conf.Separator == "" {
+		return conf, errors.New("The separator must not be empty.")
+	}
+	if conf.Size < 1 {
+		return conf, errors.New(fmt.Sprintf("Invalid summary size %d.", conf.Size))
+	}
+	if conf.Overlap < 0 || conf.Overlap >= 1 {
+		return conf, errors.New(fmt.Sprintf("Invalid overlap %g, expected at least 0 and less than 1.", conf.Overlap))
+	}
+	if conf.Alternatives < 0 {
+		return conf, errors.New(fmt.Sprintf("Invalid number of alternatives %d.", conf.Alternatives))
+	}
+	if conf.DrillDown < 0 {
+		return conf, errors.New(fmt.Sprintf("Invalid drill-down depth %d.", conf.DrillDown))
+	}
+	return conf, nil
+}
+
+// parseValue parses a value like venue=SIGMOD or venue!=SIGMOD
+func parseValue(value string) (summarize.Value, error) {
+	if i := strings.Index(value, "!="); i > 0 {
+		return summarize.MakeValue(value[:i], value[i+2:], true), nil
+	}
+	if i := strings.Index(value, "="); i > 0 {
+		return summarize.MakeValue(value[:i], value[i+1:], false), nil
+	}
+	return summarize.Value{}, errors.New(fmt.Sprintf("Invalid value %s, expected attribute=value.", value))
+}
+
+func splitList(list string) []string {
+	values := strings.Split(list, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values
+}
+
+// readRows reads the rows of the input and the attribute names that the input has, if any
+func readRows(input io.Reader, conf config) ([]string, [][]string, error) {
+	if conf.Format == "jsonl" {
+		return readJSONLines(input, conf.Names, conf.Separator)
+	}
+
+	reader := csv.NewReader(bufio.NewReader(input))
+	if conf.Format == "tsv" {
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !conf.Header {
+		return nil, rows, nil
+	}
+	if len(rows) == 0 {
+		return nil, nil, errors.New("Missing header row.")
+	}
+	return rows[0], rows[1:], nil
+}
+
+// readJSONLines reads one object per line, the attribute names are the keys of the first object unless they are given
+// the elements of arrays are joined with the separator
+func readJSONLines(input io.Reader, names []string, separator string) ([]string, [][]string, error) {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+
+	var rows [][]string
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		// numbers keep their text so that large ids are not written like 1.234567e+06
+		var object map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Invalid JSON in line %d: %s", line, err))
+		}
+		if names == nil {
+			for name := range object {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+
+		row := make([]string, len(names))
+		for i, name := range names {
+			row[i] = jsonValue(object[name], separator)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return names, rows, nil
+}
+
+// jsonValue converts a JSON value to a raw value, arrays are sets or hierarchies with elements joined by the separator
+func jsonValue(value interface{}, separator string) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, element := range v {
+			values[i] = jsonValue(element, separator)
+		}
+		return strings.Join(values, separator)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// checkSchema fills in the default types and weights and returns the assessor
+func checkSchema(conf *config) (summarize.Assessor, error) {
+	var assessor summarize.Assessor
+	numAttrs := len(conf.Names)
+	if numAttrs == 0 {
+		return assessor, errors.New("Missing attribute names.")
+	}
+	if conf.Types == nil {
+		conf.Types = make([]string, numAttrs)
+		for i := range conf.Types {
+			conf.Types[i] = "single"
+		}
+	}
+	if len(conf.Types) != numAttrs {
+		return assessor, errors.New(fmt.Sprintf("Wrong number of types. Expected %d but got %d.", numAttrs, len(conf.Types)))
+	}
+	for _, t := range conf.Types {
+		switch {
+		case t == "single", t == "set", t == "hierarchy", t == "time", strings.HasPrefix(t, "time:"):
+		default:
+			return assessor, errors.New(fmt.Sprintf("Unknown attribute type %s.", t))
+		}
+	}
+	if conf.Weights == nil {
+		conf.Weights = make([]float64, numAttrs)
+		for i := range conf.Weights {
+			conf.Weights[i] = 1
+		}
+	}
+	if len(conf.Weights) != numAttrs {
+		return assessor, errors.New(fmt.Sprintf("Wrong number of weights. Expected %d but got %d.", numAttrs, len(conf.Weights)))
+	}
+
+	switch conf.WeightFunc {
+	case "equal":
+		assessor = summarize.MakeEqualWeightAssessor()
+	case "exponential":
+		assessor = summarize.MakeExponentialAssessor(conf.Weights)
+	case "linear":
+		assessor = summarize.MakeLinearAssessor(conf.Weights)
+	case "attribute":
+		assessor = summarize.MakeOnlyAttributeAssessor(conf.Weights)
+	default:
+		return assessor, errors.New(fmt.Sprintf("Unknown weight function %s.", conf.WeightFunc))
+	}
+	return assessor, nil
+}
+
+// buildIndex indexes the rows, sets and hierarchies are split at the separator
+func buildIndex(rows [][]string, conf config, assessor summarize.Assessor) (*summarize.RelationIndex, error) {
+	workers := conf.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var partitions []summarize.Partition
+	partitionSize := (len(rows) + 4*workers - 1) / (4 * workers)
+	if partitionSize < 1 {
+		partitionSize = 1
+	}
+	for start := 0; start < len(rows); start += partitionSize {
+		end := start + partitionSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		partitions = append(partitions, rows[start:end])
+	}
+
+	return summarize.NewIndexFromSeparatedPartitions(conf.Types, conf.Names, partitions, conf.Separator, assessor, workers)
+}
+
+// writeResult writes the summary and its drill-down in an output format
+// JSON has the summaries of the formulas as children, CSV numbers nested formulas like 1.2 and tables follow each other
+// alternatives are in the JSON of each summary, in CSV rows numbered like 1~2 and in a list below each table
+func writeResult(w io.Writer, tree *summarize.DrillDown, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if tree.Children == nil {
+			return encoder.Encode(tree.SummaryResult)
+		}
+		return encoder.Encode(tree)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"formula", "cover", "attribute", "type", "value", "negated", "disjuncts"})
+		writeCSV(writer, tree, "")
+		writer.Flush()
+		return writer.Error()
+	default:
+		writeTables(w, tree, "", nil)
+		return nil
+	}
+}
+
+func writeCSV(writer *csv.Writer, tree *summarize.DrillDown, prefix string) {
+	for i, values := range tree.Summary {
+		formula := prefix + strconv.Itoa(i+1)
+		cover := strconv.FormatFloat(tree.FormulaCover[i], 'g', -1, 64)
+		writeCSVFormula(writer, formula, cover, values)
+		if i < len(tree.Alternatives) {
+			for j, alternative := range tree.Alternatives[i] {
+				writeCSVFormula(writer, formula+"~"+strconv.Itoa(j+1), strconv.FormatFloat(alternative.Cover, 'g', -1, 64), alternative.Formula)
+			}
+		}
+		if tree.Children != nil {
+			writeCSV(writer, tree.Children[i], formula+".")
+		}
+	}
+}
+
+// writeCSVFormula writes a row for every value of a formula
+func writeCSVFormula(writer *csv.Writer, formula string, cover string, values []summarize.Value) {
+	for _, value := range values {
+		writer.Write([]string{
+			formula,
+			cover,
+			value.AttributeName(),
+			value.AttributeType().String(),
+			value.Value(),
+			strconv.FormatBool(value.Negated()),
+			strings.Join(value.Disjuncts(), " "),
+		})
+	}
+}
+
+// writeTables writes the summary and then the summaries within each formula, path describes the formulas above
+func writeTables(w io.Writer, tree *summarize.DrillDown, prefix string, path []string) {
+	if len(path) > 0 {
+		fmt.Fprintf(w, "\nWithin %s (%d tuples):\n", strings.Join(path, " and "), tree.NumTuples)
+	}
+	tree.Fprint(w)
+	for i, alternatives := range tree.Alternatives {
+		if len(alternatives) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "Instead of %s%d [%s]:\n", prefix, i+1, describe(tree.Summary[i]))
+		for _, alternative := range alternatives {
+			fmt.Fprintf(w, "  %s (cover: %g)\n", describe(alternative.Formula), alternative.Cover)
+		}
+	}
+	for i, child := range tree.Children {
+		formula := prefix + strconv.Itoa(i+1)
+		description := fmt.Sprintf("%s [%s]", formula, describe(tree.Summary[i]))
+		writeTables(w, child, formula+".", append(path[:len(path):len(path)], description))
+	}
+}
+
+// describe writes a formula like venue=SIGMOD, year={2014, 2015}
+func describe(values []summarize.Value) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		switch {
+		case value.Negated():
+			parts[i] = fmt.Sprintf("%s!=%s", value.AttributeName(), value.Value())
+		case len(value.Disjuncts()) > 0:
+			parts[i] = fmt.Sprintf("%s={%s}", value.AttributeName(), strings.Join(append([]string{value.Value()}, value.Disjuncts()...), ", "))
+		default:
+			parts[i] = fmt.Sprintf("%s=%s", value.AttributeName(), value.Value())
+		}
+	}
+	return strings.Join(parts, ", ")
+}
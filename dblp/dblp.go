@@ -2,11 +2,18 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha1"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,105 +22,401 @@ import (
 )
 
 var database = flag.String("db", "./dblp.sqlite", "the sqlite database")
+var cache = flag.String("cache", "", "directory for index snapshots, indexes are rebuilt for every query if empty")
+var configPath = flag.String("config", "", "JSON file with the query, columns, weight function and summary size")
+var size = flag.Int("size", 0, "number of formulas, overrides the config")
+var query = flag.String("query", "", "summarize the results of this full text query and exit instead of asking for queries")
+var historyPath = flag.String("history", "", "file that keeps the entered queries between sessions")
+
+// config describes what is summarized
+type config struct {
+	Query      string             `json:"query"`      // selects the columns, ? is the full text query
+	Columns    []summarize.Column `json:"columns"`    // columns of the query result and how they are summarized
+	WeightFunc string             `json:"weightfunc"` // equal, exponential, linear or attribute
+	Size       int                `json:"size"`       // number of formulas
+}
+
+// the columns of the data table and how they are summarized if there is no config file
+var defaultConfig = config{
+	"",
+	[]summarize.Column{
+		{Name: "author", Type: "set", Weight: 1, Separator: ","},
+		{Name: "school", Type: "single", Weight: 0.7},
+		{Name: "journal", Type: "single", Weight: 0.6},
+		{Name: "publisher", Type: "single", Weight: 0.3},
+		{Name: "year", Type: "single", Weight: 0.1},
+		{Name: "organization", Type: "single", Weight: 0.7},
+		{Name: "institution", Type: "single", Weight: 0.7},
+	},
+	"exponential",
+	16,
+}
+
+// number of rows that :explain shows
+const explainRows = 5
+
+const help = `Enter a full text query (e.g. 'database') or a command:
+  :size N               number of formulas
+  :weights              show the attribute weights
+  :weights name=w ...   change attribute weights and rebuild the index
+  :explain N            show formula N of the last summary and rows that it covers
+  :history              show the previous queries
+  !N                    run query N of the history again
+  :help                 show this help
+  :quit                 exit`
+
+// session is the state of the interactive loop
+type session struct {
+	db       *sql.DB
+	conf     config
+	query    string                   // the last full text query
+	relation *summarize.RelationIndex // index of the last query
+	result   summarize.SummaryResult  // summary of the last query
+	history  []string                 // entered queries
+}
 
 func main() {
 	flag.Parse()
-	db, err := sql.Open("sqlite3", *database)
-	checkErr(err)
 
-	for true {
+	conf, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Enter Query (e.g. 'database'): ")
+	db, err := sql.Open("sqlite3", *database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
 
-		query, err := reader.ReadString('\n')
-		checkErr(err)
+	s := &session{db: db, conf: conf}
 
-		stmt, err := db.Prepare("select count(*) from data where data match ?")
-		checkErr(err)
-		defer stmt.Close()
-		var numTuples int
-		err = stmt.QueryRow(query).Scan(&numTuples)
-		if err != nil {
+	if *query != "" {
+		if err := s.run(*query); err != nil {
 			log.Fatal(err)
 		}
-		fmt.Println("# of results:", numTuples)
+		return
+	}
 
-		types := []string{"set", "single", "single", "single", "single", "single", "single"}
-		names := []string{"author", "school", "journal", "publisher", "year", "organization", "institution"}
-		weights := []float64{1, 0.7, 0.6, 0.3, 0.1, 0.7, 0.7}
+	s.loadHistory()
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("Type :help for commands.")
+	for {
+		fmt.Print("Enter Query (e.g. 'database'): ")
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && len(line) == 0 {
+			fmt.Println()
+			return
+		}
+		if err != nil && err != io.EOF {
+			log.Fatal(err)
+		}
 
-		assessor := summarize.MakeExponentialAssessor(weights)
-		assessor.NumTuples = numTuples
+		line = strings.TrimSpace(line)
+		if line == ":quit" {
+			return
+		}
+		if err := s.handle(line); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+}
 
-		relation, err := summarize.NewIndex(types, names, numTuples)
+// loadConfig reads the config file and applies the flags
+func loadConfig() (config, error) {
+	conf := defaultConfig
+	if *configPath != "" {
+		data, err := ioutil.ReadFile(*configPath)
 		if err != nil {
-			log.Fatal(err)
+			return conf, err
+		}
+		conf = config{}
+		if err := json.Unmarshal(data, &conf); err != nil {
+			return conf, errors.New(fmt.Sprintf("Invalid config file %s: %s", *configPath, err))
 		}
+		if len(conf.Columns) == 0 {
+			return conf, errors.New("The config has no columns.")
+		}
+		if conf.WeightFunc == "" {
+			conf.WeightFunc = defaultConfig.WeightFunc
+		}
+		if conf.Size == 0 {
+			conf.Size = defaultConfig.Size
+		}
+	}
+	if *size > 0 {
+		conf.Size = *size
+	}
+	if conf.Query == "" {
+		names := make([]string, len(conf.Columns))
+		for i, column := range conf.Columns {
+			names[i] = column.Name
+		}
+		conf.Query = fmt.Sprintf("select %s from data where data match ? order by rowid", strings.Join(names, ", "))
+	}
+	if _, err := weightFunc(conf.WeightFunc); err != nil {
+		return conf, err
+	}
+	return conf, nil
+}
 
-		attrs := relation.Attrs()
-
-		rows, err := db.Query("select author, school, journal, publisher, year, organization, institution from data where data match ?", query)
-		checkErr(err)
-		defer rows.Close()
-
-		i := 0
-		for rows.Next() {
-			var authors string
-			var school string
-			var journal string
-			var publisher string
-			var year string
-			var organization string
-			var institution string
-			err = rows.Scan(&authors, &school, &journal, &publisher, &year, &organization, &institution)
-			checkErr(err)
-
-			for _, author := range strings.Split(authors, ",") {
-				author = strings.TrimSpace(author)
-				if len(author) > 0 {
-					(*attrs)[0].AddCell(author, i, assessor)
-				}
-			}
+func weightFunc(name string) (summarize.WeightFunc, error) {
+	switch name {
+	case "equal":
+		return summarize.Equal, nil
+	case "exponential":
+		return summarize.Exponential, nil
+	case "linear":
+		return summarize.Linear, nil
+	case "attribute":
+		return summarize.OnlyAttribute, nil
+	}
+	return 0, errors.New(fmt.Sprintf("Unknown weight function %s.", name))
+}
 
-			if len(school) > 0 {
-				(*attrs)[1].AddCell(school, i, assessor)
-			}
-			if len(journal) > 0 {
-				(*attrs)[2].AddCell(journal, i, assessor)
-			}
+// handle runs a command or a query
+func (s *session) handle(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
 
-			if len(publisher) > 0 {
-				(*attrs)[3].AddCell(publisher, i, assessor)
+	switch {
+	case fields[0] == ":help":
+		fmt.Println(help)
+	case fields[0] == ":size":
+		if len(fields) != 2 {
+			return errors.New("Usage: :size N")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 {
+			return errors.New(fmt.Sprintf("Invalid size %s.", fields[1]))
+		}
+		s.conf.Size = n
+		return s.summarize()
+	case fields[0] == ":weights":
+		if len(fields) == 1 {
+			for _, column := range s.conf.Columns {
+				fmt.Printf("%s (%s): %g\n", column.Name, column.Type, column.Weight)
 			}
+			return nil
+		}
+		return s.setWeights(fields[1:])
+	case fields[0] == ":explain":
+		if len(fields) != 2 {
+			return errors.New("Usage: :explain N")
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > len(s.result.Summary) {
+			return errors.New(fmt.Sprintf("There is no formula %s.", fields[1]))
+		}
+		return s.explain(n - 1)
+	case fields[0] == ":history":
+		for i, q := range s.history {
+			fmt.Printf("%3d  %s\n", i+1, q)
+		}
+	case strings.HasPrefix(fields[0], "!"):
+		n, err := strconv.Atoi(fields[0][1:])
+		if err != nil || n < 1 || n > len(s.history) {
+			return errors.New(fmt.Sprintf("There is no query %s in the history.", fields[0][1:]))
+		}
+		return s.run(s.history[n-1])
+	case strings.HasPrefix(fields[0], ":"):
+		return errors.New(fmt.Sprintf("Unknown command %s. Type :help for commands.", fields[0]))
+	default:
+		s.addHistory(line)
+		return s.run(line)
+	}
+	return nil
+}
 
-			if len(year) > 0 {
-				(*attrs)[4].AddCell(year, i, assessor)
-			}
+// run loads the index for a query and summarizes it
+func (s *session) run(q string) error {
+	relation, err := loadIndex(s.db, s.conf, q)
+	if err != nil {
+		return err
+	}
+	s.query = q
+	s.relation = relation
+	return s.summarize()
+}
+
+// summarize summarizes the index of the last query
+func (s *session) summarize() error {
+	if s.relation == nil {
+		return nil
+	}
+	s.relation.Reset()
+
+	start := time.Now()
+	s.result = s.relation.Summarize(s.conf.Size)
+	log.Printf("Summarization took %s\n", time.Since(start))
+
+	s.result.DebugPrint()
+	return nil
+}
 
-			if len(organization) > 0 {
-				(*attrs)[5].AddCell(organization, i, assessor)
+// setWeights changes the weights of columns from name=weight pairs and rebuilds the index
+func (s *session) setWeights(pairs []string) error {
+	columns := append([]summarize.Column{}, s.conf.Columns...)
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return errors.New(fmt.Sprintf("Expected name=weight but got %s.", pair))
+		}
+		weight, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid weight %s.", parts[1]))
+		}
+		found := false
+		for i := range columns {
+			if columns[i].Name == parts[0] || columns[i].Attribute == parts[0] {
+				columns[i].Weight = weight
+				found = true
 			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("Unknown column %s.", parts[0]))
+		}
+	}
+	s.conf.Columns = columns
+
+	if s.query == "" {
+		return nil
+	}
+	return s.run(s.query)
+}
+
+// explain prints a formula of the last summary and the first rows that satisfy it
+func (s *session) explain(i int) error {
+	formula := s.result.Summary[i]
+	fmt.Printf("Formula %d covers %g:\n", i+1, s.result.FormulaCover[i])
+	for _, value := range formula {
+		operator := "="
+		if value.Negated() {
+			operator = "!="
+		}
+		values := append([]string{value.Value()}, value.Disjuncts()...)
+		fmt.Printf("  %s (%s) %s %s\n", value.AttributeName(), value.AttributeType(), operator, strings.Join(values, " | "))
+	}
+
+	members := s.relation.Members(formula)
+	fmt.Printf("%d of %d results satisfy it", len(members), s.relation.NumTuples())
+	if len(members) > explainRows {
+		members = members[:explainRows]
+		fmt.Printf(", the first %d are", explainRows)
+	}
+	fmt.Println(":")
+
+	rows, err := s.db.Query(s.conf.Query, s.query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]sql.NullString, len(names))
+	dest := make([]interface{}, len(names))
+	for i := range values {
+		dest[i] = &values[i]
+	}
 
-			if len(institution) > 0 {
-				(*attrs)[6].AddCell(institution, i, assessor)
+	for tuple := 0; len(members) > 0 && rows.Next(); tuple++ {
+		if tuple != members[0] {
+			continue
+		}
+		members = members[1:]
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		var fields []string
+		for i, value := range values {
+			if value.Valid && len(value.String) > 0 {
+				fields = append(fields, fmt.Sprintf("%s: %s", names[i], value.String))
 			}
+		}
+		fmt.Printf("  %d. %s\n", tuple, strings.Join(fields, ", "))
+	}
+	return rows.Err()
+}
 
-			i++
+func (s *session) loadHistory() {
+	if *historyPath == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(*historyPath)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			s.history = append(s.history, line)
 		}
+	}
+}
+
+func (s *session) addHistory(q string) {
+	s.history = append(s.history, q)
+	if *historyPath == "" {
+		return
+	}
+	f, err := os.OpenFile(*historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Cannot write the history: %s\n", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, q)
+}
+
+// loadIndex reads the index for a query from the cache or builds it from the database
+func loadIndex(db *sql.DB, conf config, q string) (*summarize.RelationIndex, error) {
+	if *cache == "" {
+		return buildIndex(db, conf, q)
+	}
 
+	// snapshots depend on the columns and weights as well as the query
+	key := fmt.Sprintf("%s\n%s\n%v\n%s", q, conf.Query, conf.Columns, conf.WeightFunc)
+	path := filepath.Join(*cache, fmt.Sprintf("%x.idx", sha1.Sum([]byte(key))))
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
 		start := time.Now()
-		summary := relation.Summarize(16)
-		elapsed := time.Since(start)
-		log.Printf("Summarization took %s\n", elapsed)
+		relation, err := summarize.ReadIndex(f)
+		if err == nil {
+			log.Printf("Loading the index from %s took %s\n", path, time.Since(start))
+			return relation, nil
+		}
+		log.Printf("Ignoring snapshot %s: %s\n", path, err)
+	}
 
-		summary.DebugPrint()
+	relation, err := buildIndex(db, conf, q)
+	if err != nil {
+		return nil, err
 	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := relation.WriteTo(f); err != nil {
+		return nil, err
+	}
+	return relation, nil
 }
 
-func checkErr(err error) {
+// buildIndex builds the index for a query from the database
+func buildIndex(db *sql.DB, conf config, q string) (*summarize.RelationIndex, error) {
+	function, err := weightFunc(conf.WeightFunc)
+	if err != nil {
+		return nil, err
+	}
+	relation, err := summarize.NewIndexFromQuery(db, conf.Columns, function, conf.Query, q)
 	if err != nil {
-		fmt.Println(err)
-		panic(err)
+		return nil, err
 	}
+	fmt.Println("# of results:", relation.NumTuples())
+	return relation, nil
 }
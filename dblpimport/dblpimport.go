@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var database = flag.String("db", "./dblp.sqlite", "the sqlite database")
+var input = flag.String("xml", "dblp.xml", "the dblp XML dump, gzipped if it ends in .gz, - for stdin")
+var fts = flag.String("fts", "fts4", "full text search module of the data table (fts3 or fts4)")
+var recordTypes = flag.String("types", "article,inproceedings,proceedings,book,incollection,phdthesis,mastersthesis", "comma separated record types to import")
+var limit = flag.Int("limit", 0, "stop after this many records, 0 imports all")
+var batchSize = flag.Int("batch", 10000, "records per transaction")
+
+// columns of the data table in the order of the dblp readme
+var columns = []string{"key", "publisher", "school", "title", "series", "journal", "author", "number", "month", "volume", "year", "howpublished", "organization", "booktitle", "institution"}
+
+// fields that can occur more than once, they are joined with commas
+var listFields = map[string]bool{"author": true}
+
+// record is a publication with its fields by column
+type record map[string]string
+
+func main() {
+	flag.Parse()
+
+	if *fts != "fts3" && *fts != "fts4" {
+		log.Fatalf("Unknown full text search module %s.\n", *fts)
+	}
+	types := make(map[string]bool)
+	for _, t := range strings.Split(*recordTypes, ",") {
+		types[strings.TrimSpace(t)] = true
+	}
+
+	reader, err := openInput(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reader.Close()
+
+	db, err := sql.Open("sqlite3", *database)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	create := fmt.Sprintf("create virtual table if not exists data using %s(%s)", *fts, strings.Join(columns, ", "))
+	if _, err := db.Exec(create); err != nil {
+		log.Fatal(err)
+	}
+
+	start := time.Now()
+	importer := importer{db: db, batchSize: *batchSize}
+	err = readRecords(reader, types, func(r record) error {
+		if *limit > 0 && importer.count >= *limit {
+			return errLimit
+		}
+		return importer.insert(r)
+	})
+	if err != nil && err != errLimit {
+		log.Fatal(err)
+	}
+	if err := importer.commit(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Imported %d records in %s\n", importer.count, time.Since(start))
+}
+
+// errLimit stops reading when enough records were imported
+var errLimit = errors.New("Record limit reached.")
+
+// openInput opens the dump and decompresses it if needed
+func openInput(path string) (io.ReadCloser, error) {
+	var f *os.File
+	if path == "-" {
+		f = os.Stdin
+	} else {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// importer inserts records in batches of transactions
+type importer struct {
+	db        *sql.DB
+	batchSize int
+	tx        *sql.Tx
+	stmt      *sql.Stmt
+	count     int // number of inserted records
+}
+
+func (im *importer) insert(r record) error {
+	if im.tx == nil {
+		tx, err := im.db.Begin()
+		if err != nil {
+			return err
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+		stmt, err := tx.Prepare(fmt.Sprintf("insert into data (%s) values (%s)", strings.Join(columns, ", "), placeholders))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		im.tx = tx
+		im.stmt = stmt
+	}
+
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		values[i] = r[column]
+	}
+	if _, err := im.stmt.Exec(values...); err != nil {
+		return err
+	}
+
+	im.count++
+	if im.count%im.batchSize == 0 {
+		if err := im.commit(); err != nil {
+			return err
+		}
+		log.Printf("Imported %d records\n", im.count)
+	}
+	return nil
+}
+
+func (im *importer) commit() error {
+	if im.tx == nil {
+		return nil
+	}
+	im.stmt.Close()
+	err := im.tx.Commit()
+	im.tx = nil
+	im.stmt = nil
+	return err
+}
+
+// readRecords streams the records of the given types from a dblp dump
+// text inside markup like <i> or <sub> is part of the field, entities of the dblp DTD are resolved
+func readRecords(r io.Reader, types map[string]bool, f func(record) error) error {
+	decoder := xml.NewDecoder(bufio.NewReaderSize(r, 1<<20))
+	decoder.Entity = xml.HTMLEntity
+	decoder.Strict = false
+	decoder.CharsetReader = charsetReader
+
+	var current record // the record that is read, nil outside of records
+	var field string   // the field that is read, empty outside of fields
+	var text strings.Builder
+	depth := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 2 && types[t.Name.Local]:
+				current = record{}
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "key" {
+						current["key"] = attr.Value
+					}
+				}
+			case depth == 3 && current != nil:
+				field = t.Name.Local
+				text.Reset()
+			}
+		case xml.CharData:
+			if field != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch {
+			case depth == 3 && field != "":
+				value := strings.Join(strings.Fields(text.String()), " ")
+				if previous, has := current[field]; has && listFields[field] {
+					current[field] = previous + ", " + value
+				} else if !has {
+					current[field] = value
+				}
+				field = ""
+			case depth == 2 && current != nil:
+				if err := f(current); err != nil {
+					return err
+				}
+				current = nil
+			}
+			depth--
+		}
+	}
+}
+
+// charsetReader decodes the ISO-8859-1 dumps, every byte is a rune
+func charsetReader(charset string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1":
+		return &latin1Reader{bufio.NewReader(r)}, nil
+	case "utf-8", "utf8":
+		return r, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unsupported charset %s.", charset))
+}
+
+type latin1Reader struct {
+	r *bufio.Reader
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n+utf8.UTFMax <= len(p) {
+		b, err := l.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		n += utf8.EncodeRune(p[n:], rune(b))
+	}
+	return n, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const dblpDescription = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<dblp>
+<article key="journals/x/M1" mdate="2017-01-01">
+<author>Anna M&uuml;ller</author>
+<author>Bob Smith</author>
+<title>On <i>Summaries</i>
+ of Data.</title>
+<year>2015</year>
+</article>
+<www key="homepages/m/AnnaMuller">
+<author>Anna M&uuml;ller</author>
+<title>Home Page</title>
+</www>
+<inproceedings key="conf/y/S2">
+<author>J` + "\xfc" + `rgen Smith</author>
+<title>Second</title>
+<year>2016</year>
+</inproceedings>
+</dblp>`
+
+func TestReadRecords(t *testing.T) {
+	types := map[string]bool{"article": true, "inproceedings": true}
+	var records []record
+	err := readRecords(strings.NewReader(dblpDescription), types, func(r record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []record{
+		{"key": "journals/x/M1", "author": "Anna Müller, Bob Smith", "title": "On Summaries of Data.", "year": "2015"},
+		{"key": "conf/y/S2", "author": "Jürgen Smith", "title": "Second", "year": "2016"},
+	}
+	if fmt.Sprint(records) != fmt.Sprint(expected) {
+		t.Error("Wrong records", records)
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"os"
+	"runtime"
 	"runtime/pprof"
 	"time"
 
@@ -15,6 +17,17 @@ import (
 var cpuprofile = flag.String("cpuprofile", "cpu.prof", "write cpu profile to file")
 var memprofile = flag.String("memprofile", "mem.prof", "write memory profile to this file")
 var weightfunc = flag.String("weightfunc", "equal", "weight function (equal or exponential)")
+var covers = flag.String("covers", "auto", "how cells store covers (auto, map or bitmap)")
+var workers = flag.Int("workers", 1, "number of goroutines that evaluate cells")
+var unique = flag.Bool("unique", false, "make every full name unique so that the attribute has as many values as tuples")
+var mapped = flag.String("mapped", "", "write the index to this file and summarize it memory-mapped")
+var sample = flag.Int("sample", 0, "summarize samples of this many tuples instead of the whole index")
+var exact = flag.Bool("exact", false, "re-score the formulas of a sample summary on the whole index")
+
+// sampler is an index that can be sampled
+type sampler interface {
+	Sample(sampling summarize.Sampling) *summarize.Sample
+}
 
 func main() {
 	flag.Parse()
@@ -45,12 +58,23 @@ func main() {
 		log.Fatal(err)
 	}
 
+	switch *covers {
+	case "map":
+		relation.SetCoverRepresentation(summarize.MapCovers)
+	case "bitmap":
+		relation.SetCoverRepresentation(summarize.BitmapCovers)
+	}
+
 	attrs := relation.Attrs()
 
 	for i := 0; i < numTuples; i++ {
 		(*attrs)[0].AddCell(randomdata.FirstName(randomdata.Female), i, assessor)
 		(*attrs)[1].AddCell(randomdata.LastName(), i, assessor)
-		(*attrs)[2].AddCell(randomdata.FullName(randomdata.RandomGender), i, assessor)
+		fullName := randomdata.FullName(randomdata.RandomGender)
+		if *unique {
+			fullName = fmt.Sprintf("%s %d", fullName, i)
+		}
+		(*attrs)[2].AddCell(fullName, i, assessor)
 
 		for j := 0; j < 3; j++ {
 			(*attrs)[3].AddCell(randomdata.City(), i, assessor)
@@ -60,12 +84,53 @@ func main() {
 		}
 	}
 
+	var memStats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&memStats)
+	log.Printf("Heap after building the index: %d KB\n", memStats.HeapAlloc>>10)
+
+	relation.Finalize()
+	runtime.GC()
+	runtime.ReadMemStats(&memStats)
+	log.Printf("Heap after finalizing the index: %d KB\n", memStats.HeapAlloc>>10)
+
+	var summarizer summarize.Summarizer = relation
+	if *mapped != "" {
+		index, err := mapIndex(relation, *mapped)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer index.Close()
+		summarizer = index
+		relation = nil
+
+		runtime.GC()
+		runtime.ReadMemStats(&memStats)
+		log.Printf("Heap after mapping the index: %d KB\n", memStats.HeapAlloc>>10)
+	}
+
 	start := time.Now()
-	summary := relation.Summarize(200)
-	elapsed := time.Since(start)
-	log.Printf("Summarization took %s\n", elapsed)
+	options := summarize.DefaultOptions
+	options.Workers = *workers
+	if *sample > 0 {
+		sampling := summarize.DefaultSampling
+		sampling.Size = *sample
+		sampling.Exact = *exact
+		samples := summarizer.(sampler).Sample(sampling)
+		log.Printf("Sampling took %s\n", time.Since(start))
+
+		start = time.Now()
+		result := samples.Summarize(200, options)
+		log.Printf("Summarization took %s\n", time.Since(start))
 
-	summary.DebugPrint()
+		result.DebugPrint()
+	} else {
+		summary := summarizer.SummarizeWithOptions(200, options)
+		elapsed := time.Since(start)
+		log.Printf("Summarization took %s\n", elapsed)
+
+		summary.DebugPrint()
+	}
 
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
@@ -77,3 +142,16 @@ func main() {
 		return
 	}
 }
+
+// mapIndex writes an index to a file and maps it into memory
+func mapIndex(relation *summarize.RelationIndex, path string) (*summarize.MappedIndex, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := relation.WriteMappedTo(f); err != nil {
+		return nil, err
+	}
+	return summarize.OpenMappedIndex(path)
+}
@@ -0,0 +1,95 @@
+package summarize
+
+import "sort"
+
+// Alternative is a formula that the search considered for a formula of a summary
+type Alternative struct {
+	Formula []Value // the formula
+	Cover   float64 // what the formula would have covered instead
+}
+
+// alternatives keeps the best formulas that the search evaluated for a formula of the summary
+// only formulas whose cover was computed exactly are kept, the search evaluates more single cells for them
+// but extensions of a formula that the search skipped because of their potential are not kept
+type alternatives struct {
+	k    int           // number of alternatives that are returned
+	kept []Alternative // the best formulas by descending cover, one more than k because the chosen formula is among them
+	keys []string      // keys of the kept formulas
+}
+
+func newAlternatives(k int) *alternatives {
+	if k <= 0 {
+		return nil
+	}
+	return &alternatives{k, nil, nil}
+}
+
+// wants returns whether a formula that covers at most potential could be one of the best alternatives
+func (a *alternatives) wants(potential float64) bool {
+	if a == nil || potential <= 0 {
+		return false
+	}
+	return len(a.kept) <= a.k || potential > a.kept[len(a.kept)-1].Cover
+}
+
+// consider remembers a formula with a cell added to it, the formula is only the cell if it is nil
+func (a *alternatives) consider(formula *Formula, cell *Cell, cover float64) {
+	if len(a.kept) > a.k && cover <= a.kept[len(a.kept)-1].Cover {
+		return
+	}
+
+	var values []Value
+	extended := false
+	if formula != nil {
+		i := formula.disjunction(*cell)
+		for j, c := range formula.cells {
+			value := Value{c.attribute.attributeType, c.attribute.attributeName, c.value(), c.negated, c.disjuncts}
+			if j == i {
+				value.disjuncts = append(append([]string{}, c.disjuncts...), cell.value())
+				extended = true
+			}
+			values = append(values, value)
+		}
+	}
+	if !extended {
+		values = append(values, Value{cell.attribute.attributeType, cell.attribute.attributeName, cell.value(), cell.negated, cell.disjuncts})
+	}
+
+	key := formulaKey(values)
+	for _, k := range a.keys {
+		if k == key {
+			return
+		}
+	}
+
+	i := sort.Search(len(a.kept), func(i int) bool { return a.kept[i].Cover < cover })
+	a.kept = append(a.kept, Alternative{})
+	copy(a.kept[i+1:], a.kept[i:])
+	a.kept[i] = Alternative{values, cover}
+	a.keys = append(a.keys, "")
+	copy(a.keys[i+1:], a.keys[i:])
+	a.keys[i] = key
+	if len(a.kept) > a.k+1 {
+		a.kept = a.kept[:a.k+1]
+		a.keys = a.keys[:a.k+1]
+	}
+}
+
+// finish returns the alternatives to the chosen formula and starts over for the next formula
+func (a *alternatives) finish(chosen []Value) []Alternative {
+	key := formulaKey(chosen)
+	result := make([]Alternative, 0, a.k)
+	for i, alternative := range a.kept {
+		if a.keys[i] != key && len(result) < a.k {
+			result = append(result, alternative)
+		}
+	}
+	a.reset()
+	return result
+}
+
+// reset forgets the formulas that were considered
+func (a *alternatives) reset() {
+	a.kept = a.kept[:0]
+	a.keys = a.keys[:0]
+}
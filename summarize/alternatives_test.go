@@ -0,0 +1,61 @@
+package summarize
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAlternatives(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	data := "single,single,set\nservice,region,tags\napi,eu,timeout db\napi,eu,timeout\napi,us,timeout\nweb,eu,disk\nweb,us,db\nweb,eu,disk"
+
+	relation, err := NewIndexFromString(data, assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := relation.SummarizeWithOptions(3, Options{Deterministic: true})
+	if plain.Alternatives != nil {
+		t.Error("Alternatives should only be returned if they are asked for", plain.Alternatives)
+	}
+
+	for _, workers := range []int{1, 4} {
+		relation, _ := NewIndexFromString(data, assessor)
+		result := relation.SummarizeWithOptions(3, Options{Deterministic: true, Workers: workers, Alternatives: 2})
+		if fmt.Sprint(result.Summary) != fmt.Sprint(plain.Summary) || result.SummaryCover != plain.SummaryCover {
+			t.Error("Alternatives should not change the summary", result.Summary, plain.Summary)
+		}
+		if len(result.Alternatives) != len(result.Summary) {
+			t.Fatal("Wrong number of alternatives", len(result.Alternatives), len(result.Summary))
+		}
+		for i, alternatives := range result.Alternatives {
+			if len(alternatives) == 0 || len(alternatives) > 2 {
+				t.Error("Wrong number of alternatives", i, alternatives)
+			}
+			for j, alternative := range alternatives {
+				if fmt.Sprint(alternative.Formula) == fmt.Sprint(result.Summary[i]) {
+					t.Error("The formula is not an alternative to itself", alternative)
+				}
+				if alternative.Cover > result.FormulaCover[i] || (j > 0 && alternative.Cover > alternatives[j-1].Cover) {
+					t.Error("Alternatives should be sorted and not cover more than the formula", alternatives, result.FormulaCover[i])
+				}
+			}
+		}
+	}
+
+	relation, _ = NewIndexFromString(data, assessor)
+	result := relation.SummarizeWithOptions(2, Options{Deterministic: true, Alternatives: 2})
+	// api or web alone would have covered less than api and timeout
+	if fmt.Sprint(result.Summary[1]) != "[{0 service api false []} {1 tags timeout false []}]" {
+		t.Fatal("Wrong summary", result.Summary)
+	}
+	if fmt.Sprint(result.Alternatives[1]) != "[{[{0 service api false []}] 3} {[{0 service web false []}] 3}]" {
+		t.Error("Wrong alternatives", result.Alternatives)
+	}
+
+	// kept formulas were not searched again
+	relation, _ = NewIndexFromString(data, assessor)
+	again := relation.Resummarize(result, 3, Options{Deterministic: true, Alternatives: 1}, 1)
+	if len(again.Alternatives) != 3 || again.Alternatives[1] != nil || len(again.Alternatives[2]) != 1 {
+		t.Error("Wrong alternatives after resummarizing", again.Alternatives)
+	}
+}
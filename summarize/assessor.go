@@ -20,10 +20,12 @@ type Assessor struct {
 	function  WeightFunc
 	NumTuples int
 	weightEnd float64
+	offset    int // added to the rank, used when a partition of a relation is indexed on its own
 }
 
 // Weight computes the cover weight of a cell
 func (a Assessor) Weight(attribute *Attribute, rank int) float64 {
+	rank += a.offset
 	switch a.function {
 	case Equal:
 		return 1.0
@@ -63,13 +65,17 @@ func (a Assessor) Weights(tuples TupleCover) float64 {
 
 func MakeEqualWeightAssessor() Assessor {
 	weights := make([]float64, 0)
-	return Assessor{weights, Equal, -1, -1}
+	return Assessor{weights, Equal, -1, -1, 0}
 }
 
 func MakeExponentialAssessor(weights []float64) Assessor {
-	return Assessor{weights, Exponential, -1, 0.5}
+	return Assessor{weights, Exponential, -1, 0.5, 0}
+}
+
+func MakeLinearAssessor(weights []float64) Assessor {
+	return Assessor{weights, Linear, -1, 0.5, 0}
 }
 
 func MakeOnlyAttributeAssessor(weights []float64) Assessor {
-	return Assessor{weights, OnlyAttribute, -1, -1}
+	return Assessor{weights, OnlyAttribute, -1, -1, 0}
 }
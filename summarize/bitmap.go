@@ -0,0 +1,255 @@
+package summarize
+
+import "math/bits"
+
+// maximum number of values in an array chunk, denser chunks are stored as bitsets
+const arrayMax = 4096
+
+// number of words in a bitset chunk
+const bitsetWords = 1 << 16 / 64
+
+// Bitmap is a compressed set of non-negative integers in the style of roaring bitmaps.
+// Values are split into chunks by their high 16 bits. Every chunk is either a sorted array of
+// the low bits if it is sparse or a bitset if it is dense. Unlike roaring bitmaps there are no
+// run-length encoded chunks, a long run of tuples takes a bitset.
+type Bitmap struct {
+	keys   []uint16      // high bits of the chunks in ascending order
+	chunks []bitmapChunk // chunks in the same order as keys
+	n      int           // number of values
+}
+
+type bitmapChunk struct {
+	array []uint16 // sorted low bits, nil if the chunk is a bitset
+	bits  []uint64 // bitset of the low bits, nil if the chunk is an array
+	n     int      // number of values in the chunk
+}
+
+// Len returns the number of values
+func (b *Bitmap) Len() int {
+	return b.n
+}
+
+// chunk returns the position of the chunk for the high bits of a value and whether it exists
+func (b *Bitmap) chunk(key uint16) (int, bool) {
+	// values are usually added in ascending order
+	if n := len(b.keys); n > 0 && b.keys[n-1] <= key {
+		return n - 1, b.keys[n-1] == key
+	}
+	lo, hi := 0, len(b.keys)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if b.keys[mid] < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, lo < len(b.keys) && b.keys[lo] == key
+}
+
+// Contains returns whether the value is in the bitmap
+func (b *Bitmap) Contains(x int) bool {
+	i, has := b.chunk(uint16(x >> 16))
+	if !has {
+		return false
+	}
+	return b.chunks[i].contains(uint16(x))
+}
+
+// Add adds a value and returns whether it was not in the bitmap before
+func (b *Bitmap) Add(x int) bool {
+	key := uint16(x >> 16)
+	i, has := b.chunk(key)
+	if !has {
+		if i < len(b.keys) && b.keys[i] < key {
+			i++
+		}
+		b.keys = append(b.keys, 0)
+		copy(b.keys[i+1:], b.keys[i:])
+		b.keys[i] = key
+		b.chunks = append(b.chunks, bitmapChunk{})
+		copy(b.chunks[i+1:], b.chunks[i:])
+		b.chunks[i] = bitmapChunk{}
+	}
+	if b.chunks[i].add(uint16(x)) {
+		b.n++
+		return true
+	}
+	return false
+}
+
+// Clear removes all values
+func (b *Bitmap) Clear() {
+	b.keys = nil
+	b.chunks = nil
+	b.n = 0
+}
+
+// Or returns a new bitmap with the values that are in either bitmap
+func (b *Bitmap) Or(other *Bitmap) *Bitmap {
+	var result Bitmap
+	it1 := b.Iterator()
+	it2 := other.Iterator()
+	x1, ok1 := it1.Next()
+	x2, ok2 := it2.Next()
+	for ok1 || ok2 {
+		switch {
+		case ok1 && (!ok2 || x1 < x2):
+			result.Add(x1)
+			x1, ok1 = it1.Next()
+		case ok2 && (!ok1 || x2 < x1):
+			result.Add(x2)
+			x2, ok2 = it2.Next()
+		default:
+			result.Add(x1)
+			x1, ok1 = it1.Next()
+			x2, ok2 = it2.Next()
+		}
+	}
+	return &result
+}
+
+// AndNot returns a new bitmap with the values that are in this bitmap but not in the other one
+func (b *Bitmap) AndNot(other *Bitmap) *Bitmap {
+	var result Bitmap
+	it := b.Iterator()
+	for x, ok := it.Next(); ok; x, ok = it.Next() {
+		if !other.Contains(x) {
+			result.Add(x)
+		}
+	}
+	return &result
+}
+
+// SizeInBytes estimates the memory used by the values
+func (b *Bitmap) SizeInBytes() int {
+	size := 2 * len(b.keys)
+	for _, c := range b.chunks {
+		size += 2*len(c.array) + 8*len(c.bits)
+	}
+	return size
+}
+
+func (c *bitmapChunk) contains(x uint16) bool {
+	if c.bits != nil {
+		return c.bits[x/64]&(1<<(x%64)) != 0
+	}
+	i := c.search(x)
+	return i < len(c.array) && c.array[i] == x
+}
+
+// each calls f with every value of the chunk in ascending order
+func (c *bitmapChunk) each(f func(x uint16)) {
+	if c.bits == nil {
+		for _, x := range c.array {
+			f(x)
+		}
+		return
+	}
+	for i, word := range c.bits {
+		for word != 0 {
+			f(uint16(i*64 + bits.TrailingZeros64(word)))
+			word &= word - 1
+		}
+	}
+}
+
+// search returns the position of the first value in the array that is not smaller than x
+func (c *bitmapChunk) search(x uint16) int {
+	if n := len(c.array); n > 0 && c.array[n-1] < x {
+		return n
+	}
+	lo, hi := 0, len(c.array)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if c.array[mid] < x {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+func (c *bitmapChunk) add(x uint16) bool {
+	if c.bits != nil {
+		mask := uint64(1) << (x % 64)
+		if c.bits[x/64]&mask != 0 {
+			return false
+		}
+		c.bits[x/64] |= mask
+		c.n++
+		return true
+	}
+
+	i := c.search(x)
+	if i < len(c.array) && c.array[i] == x {
+		return false
+	}
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = x
+	c.n++
+
+	// dense chunks are smaller as bitsets
+	if c.n > arrayMax {
+		c.bits = make([]uint64, bitsetWords)
+		for _, v := range c.array {
+			c.bits[v/64] |= 1 << (v % 64)
+		}
+		c.array = nil
+	}
+	return true
+}
+
+// BitmapIterator iterates over the values of a bitmap in ascending order
+type BitmapIterator struct {
+	bitmap *Bitmap
+	chunk  int    // position of the current chunk
+	pos    int    // position in the array or word in the bitset of the current chunk
+	word   uint64 // bits of the current word that were not returned yet
+}
+
+// Iterator returns an iterator that starts at the smallest value
+func (b *Bitmap) Iterator() BitmapIterator {
+	it := BitmapIterator{b, 0, 0, 0}
+	if len(b.chunks) > 0 && b.chunks[0].bits != nil {
+		it.word = b.chunks[0].bits[0]
+	}
+	return it
+}
+
+// Next returns the next value or false if there are no more values
+func (it *BitmapIterator) Next() (int, bool) {
+	for it.chunk < len(it.bitmap.chunks) {
+		c := &it.bitmap.chunks[it.chunk]
+		high := int(it.bitmap.keys[it.chunk]) << 16
+
+		if c.bits == nil {
+			if it.pos < len(c.array) {
+				x := high | int(c.array[it.pos])
+				it.pos++
+				return x, true
+			}
+		} else {
+			for it.word == 0 && it.pos < bitsetWords-1 {
+				it.pos++
+				it.word = c.bits[it.pos]
+			}
+			if it.word != 0 {
+				low := it.pos*64 + bits.TrailingZeros64(it.word)
+				it.word &= it.word - 1
+				return high | low, true
+			}
+		}
+
+		// move on to the next chunk
+		it.chunk++
+		it.pos = 0
+		it.word = 0
+		if it.chunk < len(it.bitmap.chunks) && it.bitmap.chunks[it.chunk].bits != nil {
+			it.word = it.bitmap.chunks[it.chunk].bits[0]
+		}
+	}
+	return 0, false
+}
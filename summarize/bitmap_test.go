@@ -0,0 +1,120 @@
+package summarize
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func values(b *Bitmap) []int {
+	var result []int
+	it := b.Iterator()
+	for x, ok := it.Next(); ok; x, ok = it.Next() {
+		result = append(result, x)
+	}
+	return result
+}
+
+func TestBitmap(t *testing.T) {
+	var b Bitmap
+
+	if !b.Add(70000) || !b.Add(3) || !b.Add(65536) || !b.Add(1) {
+		t.Error("Should add new values")
+	}
+	if b.Add(3) {
+		t.Error("Should not add existing values")
+	}
+	if b.Len() != 4 {
+		t.Error("Wrong length", b.Len())
+	}
+	if !b.Contains(65536) || b.Contains(2) || b.Contains(65537) {
+		t.Error("Wrong membership")
+	}
+
+	expected := []int{1, 3, 65536, 70000}
+	for i, x := range values(&b) {
+		if x != expected[i] {
+			t.Error("Wrong order", values(&b))
+		}
+	}
+
+	b.Clear()
+	if b.Len() != 0 || b.Contains(1) || len(values(&b)) != 0 {
+		t.Error("Should be empty")
+	}
+}
+
+func TestBitmapDense(t *testing.T) {
+	var b Bitmap
+	for x := 0; x < 3*arrayMax; x += 2 {
+		b.Add(x)
+	}
+	if b.chunks[0].bits == nil {
+		t.Error("Dense chunk should be a bitset")
+	}
+	if b.Len() != 3*arrayMax/2 {
+		t.Error("Wrong length", b.Len())
+	}
+	for i, x := range values(&b) {
+		if x != 2*i {
+			t.Fatal("Wrong value", i, x)
+		}
+	}
+	if !b.Contains(arrayMax) || b.Contains(arrayMax+1) {
+		t.Error("Wrong membership")
+	}
+}
+
+func TestBitmapRandom(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	var b1, b2 Bitmap
+	set1 := make(map[int]bool)
+	set2 := make(map[int]bool)
+
+	for i := 0; i < 20000; i++ {
+		x := random.Intn(200000)
+		if b1.Add(x) == set1[x] {
+			t.Fatal("Add should return whether the value is new", x)
+		}
+		set1[x] = true
+
+		y := random.Intn(100000)
+		b2.Add(y)
+		set2[y] = true
+	}
+
+	check := func(b *Bitmap, set map[int]bool) {
+		var expected []int
+		for x := range set {
+			expected = append(expected, x)
+		}
+		sort.Ints(expected)
+		actual := values(b)
+		if len(actual) != len(expected) || b.Len() != len(expected) {
+			t.Fatal("Wrong length", len(actual), len(expected))
+		}
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Fatal("Wrong value", actual[i], expected[i])
+			}
+		}
+	}
+
+	check(&b1, set1)
+	check(&b2, set2)
+
+	union := make(map[int]bool)
+	difference := make(map[int]bool)
+	for x := range set1 {
+		union[x] = true
+		if !set2[x] {
+			difference[x] = true
+		}
+	}
+	for x := range set2 {
+		union[x] = true
+	}
+
+	check(b1.Or(&b2), union)
+	check(b1.AndNot(&b2), difference)
+}
@@ -0,0 +1,88 @@
+package summarize
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeFormat describes how the values of a time attribute are parsed and indexed
+type TimeFormat struct {
+	Layouts []string // layouts as in time.Parse, tried in order
+	Hours   bool     // whether to add an hour level below the day
+}
+
+// DefaultTimeFormat is used for time attributes without an explicit layout
+var DefaultTimeFormat = TimeFormat{
+	[]string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"},
+	false,
+}
+
+// SetTimeFormat changes how values of a time attribute are parsed
+func (attr *Attribute) SetTimeFormat(format TimeFormat) {
+	attr.timeFormat = format
+}
+
+// AddTime parses a value and adds a cell for every level of the calendar hierarchy
+func (attr *Attribute) AddTime(value string, tuple int, assessor Assessor) error {
+	t, err := attr.timeFormat.parse(value)
+	if err != nil {
+		return err
+	}
+	attr.addPath(calendarPath(t, attr.timeFormat.Hours), tuple, assessor)
+	return nil
+}
+
+func (format TimeFormat) parse(value string) (time.Time, error) {
+	for _, layout := range format.Layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	err := fmt.Sprintf("Cannot parse time '%s' with layouts %v.", value, format.Layouts)
+	return time.Time{}, errors.New(err)
+}
+
+// calendarPath splits a time into year, quarter, month, day and optionally hour levels
+func calendarPath(t time.Time, hours bool) []string {
+	path := []string{
+		fmt.Sprintf("%04d", t.Year()),
+		fmt.Sprintf("Q%d", (int(t.Month())-1)/3+1),
+		fmt.Sprintf("%02d", int(t.Month())),
+		fmt.Sprintf("%02d", t.Day()),
+	}
+	if hours {
+		path = append(path, fmt.Sprintf("%02d", t.Hour()))
+	}
+	return path
+}
+
+// humanizeTime renders a calendar path at its most specific level, e.g. "2015/Q2/05" becomes "May 2015"
+func humanizeTime(value string) string {
+	levels := strings.Split(value, "/")
+	numbers := make([]int, len(levels))
+	for i, level := range levels {
+		n, err := strconv.Atoi(strings.TrimPrefix(level, "Q"))
+		if err != nil {
+			return value
+		}
+		numbers[i] = n
+	}
+
+	switch len(levels) {
+	case 1:
+		return levels[0]
+	case 2:
+		return fmt.Sprintf("%s %s", levels[1], levels[0])
+	case 3:
+		return fmt.Sprintf("%s %d", time.Month(numbers[2]), numbers[0])
+	case 4:
+		return fmt.Sprintf("%d %s %d", numbers[3], time.Month(numbers[2]), numbers[0])
+	case 5:
+		return fmt.Sprintf("%d %s %d %02d:00", numbers[3], time.Month(numbers[2]), numbers[0], numbers[4])
+	default:
+		return value
+	}
+}
@@ -0,0 +1,78 @@
+package summarize
+
+import "testing"
+
+func TestTimeIndex(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("time\nx\n2015-05-17\n2015-05-03 10:30\n2015-11-01", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attr := relation.attrs[0]
+	expected := map[string]int{
+		"2015":          3,
+		"2015/Q2":       2,
+		"2015/Q2/05":    2,
+		"2015/Q2/05/17": 1,
+		"2015/Q2/05/03": 1,
+		"2015/Q4/11/01": 1,
+	}
+	for value, count := range expected {
+		idx := attr.find(value)
+		if idx < 0 {
+			t.Error("Missing value", value)
+			continue
+		}
+		if attr.cells[idx].size() != count {
+			t.Error("Wrong cover for", value, attr.cells[idx].size())
+		}
+	}
+	if len(attr.cells) != 8 {
+		t.Error("Wrong number of cells", len(attr.cells))
+	}
+}
+
+func TestTimeLayout(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	if _, err := NewIndexFromString("time:02.01.2006\nx\n17.05.2015", assessor); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewIndexFromString("time:02.01.2006\nx\n2015-05-17", assessor); err == nil {
+		t.Error("Should not parse")
+	}
+}
+
+func TestTimeHours(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("time:hours,time:hours:02.01.2006 15h,time\nx,y,z\n2015-05-17 09:30,17.05.2015 09h,2015-05-17 09:30", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, attr := range relation.attrs[:2] {
+		if attr.find("2015/Q2/05/17/09") < 0 || len(attr.cells) != 5 {
+			t.Error("Time should have an hour level", attr.attributeName, len(attr.cells))
+		}
+	}
+	if relation.attrs[2].find("2015/Q2/05/17/09") >= 0 || len(relation.attrs[2].cells) != 4 {
+		t.Error("Time should not have an hour level by default", len(relation.attrs[2].cells))
+	}
+	if _, err := NewIndexFromString("time:hours:02.01.2006\nx\n2015-05-17", assessor); err == nil {
+		t.Error("Should not parse with the layout after hours")
+	}
+}
+
+func TestHumanizeTime(t *testing.T) {
+	cases := map[string]string{
+		"2015":             "2015",
+		"2015/Q2":          "Q2 2015",
+		"2015/Q2/05":       "May 2015",
+		"2015/Q2/05/17":    "17 May 2015",
+		"2015/Q2/05/17/09": "17 May 2015 09:00",
+	}
+	for value, expected := range cases {
+		if humanizeTime(value) != expected {
+			t.Error("Wrong rendering", humanizeTime(value), expected)
+		}
+	}
+}
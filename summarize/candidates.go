@@ -0,0 +1,158 @@
+package summarize
+
+// candidates finds the cells that can extend a formula
+// only cells that share tuples with the formula can improve it so we do not have to look at the others
+type candidates struct {
+	cells   []*RankedCell // all ranked cells by order
+	offsets []int         // tuple t is covered by the cells in orders[offsets[t]:offsets[t+1]]
+	orders  []int32       // orders of the cells that cover a tuple
+	added   []int         // number of the formula for which a cell was last added, by order
+	formula int           // number of the current formula
+	seed    *RankedCell   // the cell that the current formula started with
+	pool    []RankedCell  // copies of the ranked cells for the current formula, reused for every formula
+	heap    CellHeap      // heap of the copies
+	overlap bool          // covered tuples keep some weight so cells that were popped off the global heap can still extend formulas
+	blocked []bool        // whether a cell must not be used in the current formula of the summary, by order
+	blocks  []int         // orders of the blocked cells
+}
+
+// newCandidates builds an index from tuples to the cells that cover them
+// without cooccurrence, no index is built and every cell is a candidate, the index takes as much memory as the covers
+func newCandidates(rankedCells CellHeap, cooccurrence bool) *candidates {
+	var c candidates
+	c.cells = make([]*RankedCell, len(rankedCells))
+	c.added = make([]int, len(rankedCells))
+	c.blocked = make([]bool, len(rankedCells))
+	c.pool = make([]RankedCell, 0, len(rankedCells))
+	c.heap = make(CellHeap, 0, len(rankedCells))
+
+	for _, cell := range rankedCells {
+		c.cells[cell.order] = cell
+	}
+	if !cooccurrence {
+		return &c
+	}
+
+	numTuples := 0
+	tuples := make([][]int, len(rankedCells))
+	for _, cell := range rankedCells {
+		tuples[cell.order] = cell.cell.coveredTuples()
+		for _, tuple := range tuples[cell.order] {
+			if tuple >= numTuples {
+				numTuples = tuple + 1
+			}
+		}
+	}
+
+	// count how many cells cover each tuple and then fill in the cells
+	c.offsets = make([]int, numTuples+1)
+	for _, cellTuples := range tuples {
+		for _, tuple := range cellTuples {
+			c.offsets[tuple+1]++
+		}
+	}
+	for t := 0; t < numTuples; t++ {
+		c.offsets[t+1] += c.offsets[t]
+	}
+	c.orders = make([]int32, c.offsets[numTuples])
+	next := append([]int{}, c.offsets[:numTuples]...)
+	for order, cellTuples := range tuples {
+		for _, tuple := range cellTuples {
+			c.orders[next[tuple]] = int32(order)
+			next[tuple]++
+		}
+	}
+
+	return &c
+}
+
+// start returns a heap with copies of the cells that can extend a formula that was started from a cell
+func (c *candidates) start(seed *RankedCell, options Options) *CellHeap {
+	c.formula++
+	c.seed = seed
+	c.pool = c.pool[:0]
+	c.heap = c.heap[:0]
+
+	c.addCooccurring(seed.cell)
+
+	// other values of the attribute never share tuples with the seed but can become alternative values
+	if options.MaxDisjuncts > 1 && seed.cell.attribute.attributeType == single && !seed.cell.negated {
+		for _, cell := range c.cells {
+			if cell.cell.attribute == seed.cell.attribute && !cell.cell.negated {
+				c.add(cell)
+			}
+		}
+	}
+
+	return &c.heap
+}
+
+// startPinned returns a heap with copies of the cells that can extend a formula of pinned cells
+// the formula only covers tuples of its first cell so the cells that share tuples with it are enough
+func (c *candidates) startPinned(first *Cell) *CellHeap {
+	c.formula++
+	c.seed = nil
+	c.pool = c.pool[:0]
+	c.heap = c.heap[:0]
+
+	c.addCooccurring(first)
+
+	return &c.heap
+}
+
+// addCooccurring adds the cells that share tuples with a cell
+// has to be called when the formula starts to cover the tuples of the cell, the heap has to be fixed afterwards
+func (c *candidates) addCooccurring(cell *Cell) {
+	// if the cell covers many tuples, most cells share tuples with it and it is faster to add all of them
+	// the expected number of lookups has to be a few times the number of cells because lookups are slower than copies
+	numTuples := len(c.offsets) - 1
+	if numTuples <= 0 || cell.size()*len(c.orders)/numTuples >= 4*len(c.cells) {
+		for _, other := range c.cells {
+			c.add(other)
+		}
+		return
+	}
+
+	for _, tuple := range cell.coveredTuples() {
+		if tuple >= len(c.offsets)-1 {
+			continue
+		}
+		for _, order := range c.orders[c.offsets[tuple]:c.offsets[tuple+1]] {
+			c.add(c.cells[order])
+		}
+	}
+}
+
+// add copies a cell into the heap unless it is already there
+func (c *candidates) add(cell *RankedCell) {
+	// cells that were popped off the global heap are completely covered and cannot improve a formula
+	if c.added[cell.order] == c.formula || cell == c.seed || c.blocked[cell.order] || (cell.index < 0 && !c.overlap) {
+		return
+	}
+	c.added[cell.order] = c.formula
+
+	// the pool never grows beyond its capacity so pointers into it stay valid
+	c.pool = append(c.pool, *cell)
+	copied := &c.pool[len(c.pool)-1]
+	copied.index = len(c.heap)
+	c.heap = append(c.heap, copied)
+}
+
+// block keeps a cell out of the formulas until unblock is called
+// returns the cell if it is on the global heap, it has to be taken off so that no formula starts with it either
+func (c *candidates) block(order int) *RankedCell {
+	c.blocked[order] = true
+	c.blocks = append(c.blocks, order)
+	if c.cells[order].index < 0 {
+		return nil
+	}
+	return c.cells[order]
+}
+
+// unblock allows the blocked cells again
+func (c *candidates) unblock() {
+	for _, order := range c.blocks {
+		c.blocked[order] = false
+	}
+	c.blocks = c.blocks[:0]
+}
@@ -3,48 +3,290 @@ package summarize
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 )
 
 type Cover struct {
-	covered bool    // whether the cell covers the cell in this tuple
-	weight  float64 // the cover weight
+	count  int     // how many formulas covered the cell in this tuple, at most one unless covers overlap
+	weight float64 // the cover weight
 }
 
 // TupleCover is a map from tuple index to whether the tuple covers it
 type TupleCover map[int]*Cover
 
+// bitmapCover is a compact alternative to TupleCover, the weights are stored once per attribute
+type bitmapCover struct {
+	tuples  Bitmap         // the tuples that the cell covers
+	covered Bitmap         // the tuples where the cell is already covered, a subset of tuples
+	members []*bitmapCover // covers of the values of a disjunctive cell, covering the cell covers them as well
+	counts  map[int]int    // how many more formulas covered a covered tuple, nil unless covers overlap
+}
+
+// cover marks a tuple as covered, overlapping covers also count how often
+func (cover *bitmapCover) cover(tuple int, overlap bool) {
+	if !cover.covered.Add(tuple) && overlap && cover.members == nil {
+		if cover.counts == nil {
+			cover.counts = make(map[int]int)
+		}
+		cover.counts[tuple]++
+	}
+	for _, member := range cover.members {
+		if member.tuples.Contains(tuple) {
+			member.cover(tuple, overlap)
+		}
+	}
+}
+
+// count returns how many formulas covered a tuple
+func (cover *bitmapCover) count(tuple int) int {
+	if !cover.covered.Contains(tuple) {
+		return 0
+	}
+	// the counts of a disjunctive cell are kept by the cells of its values
+	for _, member := range cover.members {
+		if member.tuples.Contains(tuple) {
+			return member.count(tuple)
+		}
+	}
+	return 1 + cover.counts[tuple]
+}
+
+// discount returns the share of the weight of a tuple that is left after count formulas covered it
+// overlap is the share that is left every time, 0 if tuples are covered once
+func discount(count int, overlap float64) float64 {
+	if count == 0 {
+		return 1
+	}
+	if overlap == 0 {
+		return 0
+	}
+	return math.Pow(overlap, float64(count))
+}
+
 // Cell is an attribute value that covers tuples
 type Cell struct {
-	covers       TupleCover // what cells the attribute covers
-	attribute    *Attribute // attribute
-	value        string     // attribute value
-	equalWeights bool       // the cover weights of this cell
+	covers       TupleCover   // what cells the attribute covers, nil if the cell uses a bitmap
+	bitmap       *bitmapCover // what cells the attribute covers, nil if the cell uses a map
+	attribute    *Attribute   // attribute
+	id           int32        // id of the value in the dictionary of the attribute
+	equalWeights bool         // the cover weights of this cell
+	negated      bool         // the cell covers the tuples that have a different value
+	disjuncts    []string     // alternative values, the covers are the union of the covers of all values
+	tuples       []int        // covered tuples in ascending order, only set for deterministic summaries
 }
 
-// MakeCell makes a new cell
+// MakeCell makes a new cell, the covers are a bitmap if the attribute uses bitmaps
 func MakeCell(attr *Attribute, value string, equalWeights bool) Cell {
+	id, _ := attr.values.intern(value)
+	return makeCell(attr, id, equalWeights)
+}
+
+// makeCell makes a new cell for a value that is already in the dictionary of the attribute
+func makeCell(attr *Attribute, id int32, equalWeights bool) Cell {
+	if attr.bitmaps {
+		return Cell{nil, new(bitmapCover), attr, id, equalWeights, false, nil, nil}
+	}
 	covers := make(TupleCover)
-	cell := Cell{covers, attr, value, equalWeights}
+	cell := Cell{covers, nil, attr, id, equalWeights, false, nil, nil}
 	return cell
 }
 
+// value returns the attribute value
+func (cell *Cell) value() string {
+	return cell.attribute.values.value(cell.id)
+}
+
+// add adds a tuple to the covers of the cell
+func (cell *Cell) add(tuple int, weight float64) {
+	// the sorted tuples do not have the new tuple
+	cell.tuples = nil
+	if cell.bitmap != nil {
+		cell.bitmap.tuples.Add(tuple)
+		if !cell.equalWeights {
+			cell.attribute.setWeight(tuple, weight)
+		}
+		return
+	}
+	cell.covers[tuple] = &Cover{0, weight}
+}
+
+// size returns the number of tuples that the cell covers
+func (cell *Cell) size() int {
+	if cell.bitmap != nil {
+		return cell.bitmap.tuples.Len()
+	}
+	return len(cell.covers)
+}
+
+// weight returns the cover weight of a tuple in a bitmap cell
+func (cell *Cell) weight(tuple int) float64 {
+	if cell.equalWeights {
+		return 1
+	}
+	return cell.attribute.weights[tuple]
+}
+
+// lookup returns the cover weight of a tuple, how many formulas covered it and whether the cell covers the tuple
+func (cell *Cell) lookup(tuple int) (float64, int, bool) {
+	if cell.bitmap != nil {
+		if !cell.bitmap.tuples.Contains(tuple) {
+			return 0, 0, false
+		}
+		return cell.weight(tuple), cell.bitmap.count(tuple), true
+	}
+	cover, has := cell.covers[tuple]
+	if !has {
+		return 0, 0, false
+	}
+	return cover.weight, cover.count, true
+}
+
+// remaining returns what a tuple that the cell covers still adds to a formula with the given overlap
+func (cell *Cell) remaining(tuple int, overlap float64) float64 {
+	weight, count, _ := cell.lookup(tuple)
+	return weight * discount(count, overlap)
+}
+
+// setCovered marks a tuple that the cell covers as covered, or covered once more if covers overlap
+func (cell *Cell) setCovered(tuple int, overlap bool) {
+	if cell.bitmap != nil {
+		cell.bitmap.cover(tuple, overlap)
+		return
+	}
+	if cover := cell.covers[tuple]; cover.count == 0 || overlap {
+		cover.count++
+	}
+}
+
+// resetCovered marks all tuples as not covered
+func (cell *Cell) resetCovered() {
+	if cell.bitmap != nil {
+		cell.bitmap.covered.Clear()
+		cell.bitmap.counts = nil
+		return
+	}
+	for _, cover := range cell.covers {
+		cover.count = 0
+	}
+}
+
 // Weight computes the sum of weights for all covered cells
 func (cell *Cell) SumWeights() float64 {
 	// shortcut since all weights are unit 1
 	if cell.equalWeights {
-		return float64(len(cell.covers))
+		return float64(cell.size())
 	}
 
 	// sum up the weights in covers
 	s := 0.0
+	if cell.tuples != nil {
+		for _, tuple := range cell.tuples {
+			weight, _, _ := cell.lookup(tuple)
+			s += weight
+		}
+		return s
+	}
+	if cell.bitmap != nil {
+		it := cell.bitmap.tuples.Iterator()
+		for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+			s += cell.attribute.weights[tuple]
+		}
+		return s
+	}
 	for _, cover := range cell.covers {
 		s += cover.weight
 	}
 	return s
 }
 
+// sortTuples remembers the covered tuples in ascending order so that sums over the covers are deterministic
+func (cell *Cell) sortTuples() {
+	if cell.bitmap != nil {
+		cell.tuples = cell.coveredTuples()
+		return
+	}
+	cell.tuples = make([]int, 0, len(cell.covers))
+	for tuple := range cell.covers {
+		cell.tuples = append(cell.tuples, tuple)
+	}
+	sort.Ints(cell.tuples)
+}
+
+// coveredTuples returns the covered tuples, in ascending order if they were sorted or the cell uses a bitmap
+func (cell *Cell) coveredTuples() []int {
+	if cell.tuples != nil {
+		return cell.tuples
+	}
+	tuples := make([]int, 0, cell.size())
+	if cell.bitmap != nil {
+		it := cell.bitmap.tuples.Iterator()
+		for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+			tuples = append(tuples, tuple)
+		}
+		return tuples
+	}
+	for tuple := range cell.covers {
+		tuples = append(tuples, tuple)
+	}
+	return tuples
+}
+
+// sortedTuples returns the covered tuples in ascending order
+func (cell *Cell) sortedTuples() []int {
+	tuples := cell.coveredTuples()
+	if cell.bitmap == nil && cell.tuples == nil {
+		sort.Ints(tuples)
+	}
+	return tuples
+}
+
+// union combines two cells of the same attribute disjunctively
+// the covers are shared so that covering the union covers the original cells
+func (cell Cell) union(other Cell) Cell {
+	disjuncts := append(append([]string{}, cell.disjuncts...), other.value())
+	disjuncts = append(disjuncts, other.disjuncts...)
+
+	var union Cell
+	if cell.bitmap != nil {
+		cover := bitmapCover{
+			*cell.bitmap.tuples.Or(&other.bitmap.tuples),
+			*cell.bitmap.covered.Or(&other.bitmap.covered),
+			[]*bitmapCover{cell.bitmap, other.bitmap},
+			nil,
+		}
+		union = Cell{nil, &cover, cell.attribute, cell.id, cell.equalWeights, false, disjuncts, nil}
+	} else {
+		covers := make(TupleCover, len(cell.covers)+len(other.covers))
+		for tuple, cover := range cell.covers {
+			covers[tuple] = cover
+		}
+		for tuple, cover := range other.covers {
+			covers[tuple] = cover
+		}
+		union = Cell{covers, nil, cell.attribute, cell.id, cell.equalWeights, false, disjuncts, nil}
+	}
+
+	if cell.tuples != nil {
+		union.sortTuples()
+	}
+	return union
+}
+
+// values returns the value and all alternative values
+func (cell Cell) values() []string {
+	return append([]string{cell.value()}, cell.disjuncts...)
+}
+
 func (cell Cell) String() string {
 	var buffer bytes.Buffer
-	fmt.Fprintf(&buffer, "Attr %s: %s", cell.attribute.attributeName, cell.value)
+	if cell.negated {
+		fmt.Fprintf(&buffer, "Attr %s: != %s", cell.attribute.attributeName, cell.value())
+	} else if len(cell.disjuncts) > 0 {
+		fmt.Fprintf(&buffer, "Attr %s: {%s}", cell.attribute.attributeName, strings.Join(cell.values(), ", "))
+	} else {
+		fmt.Fprintf(&buffer, "Attr %s: %s", cell.attribute.attributeName, cell.value())
+	}
 	return buffer.String()
 }
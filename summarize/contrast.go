@@ -0,0 +1,235 @@
+package summarize
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// ContrastMeasure decides how covering the background counts against covering the target
+type ContrastMeasure int
+
+const (
+	// what a formula covers of the target minus the penalty times what it covers of the background
+	Difference ContrastMeasure = iota
+	// like Difference but every relation counts relative to its number of tuples, so relations of different sizes are comparable
+	Relative
+)
+
+// Contrast configures contrastive summaries
+type Contrast struct {
+	Measure ContrastMeasure // how the covers of the target and the background are combined
+	Penalty float64         // how much covering the background counts against a formula
+}
+
+// DefaultContrast compares the shares of the target and of the background that formulas cover
+var DefaultContrast = Contrast{
+	Relative,
+	1,
+}
+
+// ContrastResult is a summary of what distinguishes a target from a background
+type ContrastResult struct {
+	SummaryResult       // the formulas, the covers are what they cover of the target minus what they cover of the background
+	Target        []int // number of tuples of the target that satisfy each formula
+	Background    []int // number of tuples of the background that satisfy each formula
+}
+
+// Contrast summarizes what distinguishes the tuples of the relation from the tuples of a background relation with the same attributes
+// formulas are built from positive cells, negations and disjunctions in the options are ignored
+func (relation *RelationIndex) Contrast(background *RelationIndex, size int, contrast Contrast, options Options) (ContrastResult, error) {
+	if len(relation.attrs) != len(background.attrs) {
+		err := fmt.Sprintf("Wrong number of attributes. Expected %d but got %d.", len(relation.attrs), len(background.attrs))
+		return ContrastResult{}, errors.New(err)
+	}
+	for ia, attr := range relation.attrs {
+		other := background.attrs[ia]
+		if attr.attributeName != other.attributeName || attr.attributeType != other.attributeType {
+			err := fmt.Sprintf("Mismatching attribute. Expected %s (%s) but got %s (%s).", attr.attributeName, attr.attributeType, other.attributeName, other.attributeType)
+			return ContrastResult{}, errors.New(err)
+		}
+	}
+
+	targetFactor, backgroundFactor := contrast.factors(relation.numTuples, background.numTuples)
+
+	typeNames := make([]string, len(relation.attrs))
+	names := make([]string, len(relation.attrs))
+	for ia, attr := range relation.attrs {
+		typeNames[ia] = attr.attributeType.String()
+		names[ia] = attr.attributeName
+	}
+	signed, _ := NewIndex(typeNames, names, relation.numTuples+background.numTuples)
+
+	// the background tuples follow the target tuples
+	for ia := range signed.attrs {
+		attr := &signed.attrs[ia]
+		attr.timeFormat = relation.attrs[ia].timeFormat
+		attr.addSigned(&relation.attrs[ia], 0, targetFactor)
+		attr.addSigned(&background.attrs[ia], relation.numTuples, -backgroundFactor)
+	}
+
+	numTarget := relation.numTuples
+	return signed.contrast(size, options, func(tuple int) bool { return tuple < numTarget }), nil
+}
+
+// ContrastTuples summarizes what distinguishes some tuples of the relation from the other tuples
+func (relation *RelationIndex) ContrastTuples(target []int, size int, contrast Contrast, options Options) ContrastResult {
+	inTarget := make([]bool, relation.numTuples)
+	numTarget := 0
+	for _, tuple := range target {
+		if tuple >= 0 && tuple < relation.numTuples && !inTarget[tuple] {
+			inTarget[tuple] = true
+			numTarget++
+		}
+	}
+	targetFactor, backgroundFactor := contrast.factors(numTarget, relation.numTuples-numTarget)
+
+	// the signed index keeps the tuple ids so the target is not contiguous
+	tuples := make([]int, relation.numTuples)
+	factors := make([]float64, relation.numTuples)
+	for tuple := range tuples {
+		tuples[tuple] = tuple
+		factors[tuple] = -backgroundFactor
+		if inTarget[tuple] {
+			factors[tuple] = targetFactor
+		}
+	}
+	signed := relation.subset(tuples, factors, func(cell *Cell) bool {
+		return !cell.negated
+	})
+
+	return signed.contrast(size, options, func(tuple int) bool { return inTarget[tuple] })
+}
+
+// factors returns how the weights of the target and the background are scaled
+func (contrast Contrast) factors(numTarget int, numBackground int) (float64, float64) {
+	penalty := contrast.Penalty
+	if contrast.Measure == Relative {
+		return 1 / math.Max(float64(numTarget), 1), penalty / math.Max(float64(numBackground), 1)
+	}
+	return 1, penalty
+}
+
+// addSigned adds the positive cells of an attribute of another index with tuples that start at an offset and scaled weights
+func (attr *Attribute) addSigned(other *Attribute, offset int, factor float64) {
+	for ic := range other.cells {
+		cell := &other.cells[ic]
+		if cell.negated {
+			continue
+		}
+		idx := attr.find(cell.value())
+		if idx < 0 {
+			idx = len(attr.cells)
+			attr.appendCell(MakeCell(attr, cell.value(), false))
+		}
+		signed := &attr.cells[idx]
+		for _, tuple := range cell.coveredTuples() {
+			weight, _, _ := cell.lookup(tuple)
+			signed.add(tuple+offset, weight*factor)
+		}
+	}
+}
+
+// contrast greedily builds formulas with the highest signed cover
+// the weights of target tuples are positive and those of background tuples negative, so adding a cell can increase the cover
+// and the upper bounds of the heaps in summarize do not hold, every cell is evaluated instead
+// only target tuples are covered so that later formulas are still penalized for background tuples
+func (relation *RelationIndex) contrast(size int, options Options, inTarget func(tuple int) bool) ContrastResult {
+	var cells []*Cell
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+			if options.Deterministic {
+				cell.sortTuples()
+			} else {
+				cell.tuples = nil
+			}
+			cells = append(cells, cell)
+		}
+	}
+
+	var result ContrastResult
+	for len(result.Summary) < size {
+		// start with the cell that covers the most
+		var best *Cell
+		bestCover := 0.0
+		for _, cell := range cells {
+			ranked := RankedCell{cell, 0, 0, -1, 0}
+			if cover := ranked.recomputeCoverage(0); cover > bestCover {
+				best, bestCover = cell, cover
+			}
+		}
+		if best == nil {
+			break
+		}
+		formula := NewFormula(*best)
+
+		// add the cell that improves the formula the most until no cell does
+		for {
+			best = nil
+			bestGain := 0.0
+			for _, cell := range cells {
+				if !formula.accepts(cell) {
+					continue
+				}
+				ranked := RankedCell{cell, math.Inf(1), 0, -1, 0}
+				if gain := ranked.recomputeFormulaCoverage(formula); gain > bestGain+coverTolerance {
+					best, bestGain = cell, gain
+				}
+			}
+			if best == nil {
+				break
+			}
+			formula.AddCell(*best)
+		}
+
+		var values []Value
+		for _, cell := range formula.cells {
+			values = append(values, Value{cell.attribute.attributeType, cell.attribute.attributeName, cell.value(), cell.negated, cell.disjuncts})
+		}
+		target, background := 0, 0
+		for tuple := range formula.tupleCover {
+			if inTarget(tuple) {
+				target++
+			} else {
+				background++
+			}
+		}
+
+		for _, cell := range formula.cells {
+			for tuple := range formula.tupleCover {
+				if _, count, has := cell.lookup(tuple); has && count == 0 && inTarget(tuple) {
+					cell.setCovered(tuple, false)
+				}
+			}
+		}
+
+		result.Summary = append(result.Summary, values)
+		result.FormulaCover = append(result.FormulaCover, formula.cover)
+		result.SummaryCover += formula.cover
+		result.Target = append(result.Target, target)
+		result.Background = append(result.Background, background)
+	}
+
+	return result
+}
+
+// accepts returns whether a cell can extend a contrastive formula
+func (formula *Formula) accepts(cell *Cell) bool {
+	for _, c := range formula.cells {
+		if c.attribute == cell.attribute && c.id == cell.id {
+			return false
+		}
+	}
+	return cell.attribute.attributeType != single || !formula.usedSingleAttributes.Has(cell.attribute.index)
+}
+
+// DebugPrint prints a contrastive summary
+func (result ContrastResult) DebugPrint() {
+	result.SummaryResult.DebugPrint()
+	for i := range result.Summary {
+		fmt.Fprintf(os.Stdout, "Formula %d: %d target and %d background tuples\n", i+1, result.Target[i], result.Background[i])
+	}
+}
@@ -0,0 +1,64 @@
+package summarize
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestContrast(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	thisWeek, err := NewIndexFromString("single,single,set\nservice,region,tags\napi,eu,timeout db\napi,eu,timeout\napi,us,timeout\nweb,eu,disk\nweb,us,db", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastWeek, err := NewIndexFromString("single,single,set\nservice,region,tags\napi,us,db\nweb,eu,disk\nweb,eu,disk\nweb,us,db", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Deterministic: true}
+
+	result, err := thisWeek.Contrast(lastWeek, 2, Contrast{Difference, 1}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// timeout only happens this week and api mostly
+	if fmt.Sprint(result.Summary[0]) != "[{1 tags timeout false []} {0 service api false []}]" {
+		t.Error("Wrong first formula", result.Summary)
+	}
+	if result.FormulaCover[0] != 6 || result.Target[0] != 3 || result.Background[0] != 0 {
+		t.Error("Wrong cover of the first formula", result.FormulaCover, result.Target, result.Background)
+	}
+	for i, cover := range result.FormulaCover {
+		if cover <= 0 {
+			t.Error("Formulas should cover more of the target than of the background", i, cover)
+		}
+	}
+
+	// the partition of one index gives the same summary
+	combined, err := NewIndexFromString("single,single,set\nservice,region,tags\napi,eu,timeout db\napi,eu,timeout\napi,us,timeout\nweb,eu,disk\nweb,us,db\napi,us,db\nweb,eu,disk\nweb,eu,disk\nweb,us,db", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partition := combined.ContrastTuples([]int{0, 1, 2, 3, 4}, 2, Contrast{Difference, 1}, options)
+	if fmt.Sprint(partition.Summary) != fmt.Sprint(result.Summary) || fmt.Sprint(partition.FormulaCover) != fmt.Sprint(result.FormulaCover) {
+		t.Error("Partition should give the same summary", partition.Summary, result.Summary)
+	}
+
+	// the inputs are not covered
+	if summary := lastWeek.Summarize(1); summary.SummaryCover != 6 {
+		t.Error("Background should not be covered", summary)
+	}
+
+	// a high penalty leaves out formulas that cover anything of the background
+	strict := combined.ContrastTuples([]int{0, 1, 2, 3, 4}, 5, Contrast{Relative, 10}, options)
+	for i := range strict.Summary {
+		if strict.Background[i] != 0 {
+			t.Error("Formula should not cover the background", strict.Summary[i])
+		}
+	}
+
+	other, _ := NewIndexFromString("single,single\nservice,region\napi,eu", assessor)
+	if _, err := thisWeek.Contrast(other, 2, DefaultContrast, options); err == nil {
+		t.Error("Should fail for different attributes")
+	}
+}
@@ -0,0 +1,118 @@
+package summarize
+
+import (
+	"sort"
+	"strings"
+)
+
+// dictionary interns the values of an attribute
+// every value is stored once in an arena and cells refer to values by their id
+type dictionary struct {
+	arena   strings.Builder  // values one after another, empty after the dictionary was finalized until a value is added
+	values  string           // contents of the arena, values are substrings of it
+	offsets []uint32         // value i is values[offsets[i]:offsets[i+1]]
+	ids     map[string]int32 // ids by value, the keys share memory with the arena, nil after the dictionary was finalized until a value is added
+	sorted  []int32          // ids ordered by their values, only set while the dictionary is finalized
+}
+
+func newDictionary() *dictionary {
+	return &dictionary{strings.Builder{}, "", []uint32{0}, make(map[string]int32), nil}
+}
+
+// len returns the number of values
+func (d *dictionary) len() int {
+	return len(d.offsets) - 1
+}
+
+// value returns the value with an id
+func (d *dictionary) value(id int32) string {
+	return d.values[d.offsets[id]:d.offsets[id+1]]
+}
+
+// lookup returns the id of a value and whether the value is in the dictionary
+// after the dictionary was finalized, the ids sorted by value are searched so that lookups do not write and can run concurrently
+func (d *dictionary) lookup(value string) (int32, bool) {
+	if d.ids == nil {
+		i := sort.Search(len(d.sorted), func(i int) bool { return d.value(d.sorted[i]) >= value })
+		if i < len(d.sorted) && d.value(d.sorted[i]) == value {
+			return d.sorted[i], true
+		}
+		return 0, false
+	}
+	id, has := d.ids[value]
+	return id, has
+}
+
+// intern returns the id of a value and whether the value was added
+// the ids are rebuilt if the dictionary was finalized
+func (d *dictionary) intern(value string) (int32, bool) {
+	if d.ids == nil {
+		d.index()
+	}
+	if id, has := d.ids[value]; has {
+		return id, false
+	}
+
+	if d.arena.Len() != len(d.values) {
+		// the arena was dropped when the dictionary was finalized
+		d.arena.Reset()
+		d.arena.WriteString(d.values)
+	}
+	d.arena.WriteString(value)
+	d.values = d.arena.String()
+
+	id := int32(d.len())
+	d.offsets = append(d.offsets, uint32(len(d.values)))
+	d.ids[d.value(id)] = id
+	return id, true
+}
+
+// index rebuilds the ids of the values
+func (d *dictionary) index() {
+	d.sorted = nil
+	d.ids = make(map[string]int32, d.len())
+	for id := int32(0); int(id) < d.len(); id++ {
+		d.ids[d.value(id)] = id
+	}
+}
+
+// compact drops the values that are not used and returns the new ids by old id, -1 for dropped values
+// a finalized dictionary stays finalized
+func (d *dictionary) compact(used []bool) []int32 {
+	ids := make([]int32, d.len())
+	values := d.values
+	d.arena.Reset()
+	offsets := []uint32{0}
+	for id := int32(0); int(id) < d.len(); id++ {
+		if !used[id] {
+			ids[id] = -1
+			continue
+		}
+		ids[id] = int32(len(offsets) - 1)
+		d.arena.WriteString(values[d.offsets[id]:d.offsets[id+1]])
+		offsets = append(offsets, uint32(d.arena.Len()))
+	}
+
+	d.values = d.arena.String()
+	d.offsets = offsets
+	if d.ids == nil {
+		d.finalize()
+	} else {
+		d.index()
+	}
+	return ids
+}
+
+// finalize replaces the ids by a slice of them sorted by value and drops the spare capacity of the arena
+// the ids are rebuilt when a value is added again
+func (d *dictionary) finalize() {
+	d.ids = nil
+	d.sorted = make([]int32, d.len())
+	for i := range d.sorted {
+		d.sorted[i] = int32(i)
+	}
+	sort.Slice(d.sorted, func(a, b int) bool { return d.value(d.sorted[a]) < d.value(d.sorted[b]) })
+	d.values = strings.Clone(d.values)
+	d.arena.Reset()
+	d.offsets = append([]uint32{}, d.offsets...)
+}
@@ -0,0 +1,104 @@
+package summarize
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// intern adds a value to the dictionary of an attribute and returns its id
+func intern(attr *Attribute, value string) int32 {
+	id, _ := attr.values.intern(value)
+	return id
+}
+
+func TestDictionary(t *testing.T) {
+	d := newDictionary()
+	for i, value := range []string{"a", "bc", "", "d"} {
+		if id, added := d.intern(value); !added || int(id) != i {
+			t.Error("Should add new values", value, id)
+		}
+	}
+	if id, added := d.intern("bc"); added || id != 1 {
+		t.Error("Should find existing values", id)
+	}
+
+	d.finalize()
+	if d.ids != nil {
+		t.Error("Finalize should drop the ids")
+	}
+	if d.value(1) != "bc" || d.value(2) != "" || d.value(3) != "d" {
+		t.Error("Wrong values after finalize")
+	}
+
+	// lookups search the ids sorted by value and do not rebuild the ids
+	if id, has := d.lookup("d"); !has || id != 3 {
+		t.Error("Should find values after finalize", id)
+	}
+	if _, has := d.lookup("x"); has || d.ids != nil {
+		t.Error("Lookups should not rebuild the ids")
+	}
+
+	// adding values after finalize rebuilds the ids
+	if id, added := d.intern("e"); !added || id != 4 {
+		t.Error("Should add new values after finalize", id)
+	}
+	if id, has := d.lookup("a"); !has || id != 0 {
+		t.Error("Should find old values after finalize", id)
+	}
+	if d.value(0) != "a" || d.value(4) != "e" || d.len() != 5 {
+		t.Error("Wrong values", d.values)
+	}
+
+	// values in random order are found by binary search
+	random := rand.New(rand.NewSource(1))
+	many := newDictionary()
+	for i := 0; i < 1000; i++ {
+		many.intern(fmt.Sprint(random.Intn(5000)))
+	}
+	many.finalize()
+	for id := int32(0); int(id) < many.len(); id++ {
+		if found, has := many.lookup(many.value(id)); !has || found != id {
+			t.Error("Should find every value after finalize", many.value(id), found)
+		}
+		if _, has := many.lookup(many.value(id) + "x"); has {
+			t.Error("Should not find missing values after finalize", many.value(id)+"x")
+		}
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+	relation, err := NewIndexFromString(partitionDescription, MakeEqualWeightAssessor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	relation.AddNegations(0.3)
+	expected := relation.SummarizeWithOptions(5, options)
+	relation.Reset()
+
+	relation.Finalize()
+	if actual := relation.SummarizeWithOptions(5, options); actual.SummaryCover != expected.SummaryCover {
+		t.Error("Finalize should not change the summary")
+	}
+
+	// concurrent readers only search the sorted ids
+	done := make(chan []int)
+	for i := 0; i < 4; i++ {
+		negated := i%2 == 1
+		go func() {
+			done <- relation.Members([]Value{{single, "w", "a", negated, nil}})
+		}()
+	}
+	sizes := make(map[int]int)
+	for i := 0; i < 4; i++ {
+		sizes[len(<-done)]++
+	}
+	if sizes[5] != 2 || sizes[4] != 2 {
+		t.Error("Wrong members after finalize", sizes)
+	}
+
+	if !relation.attrs[0].AddCell("z", 0, MakeEqualWeightAssessor()) || relation.attrs[0].AddCell("a", 0, MakeEqualWeightAssessor()) {
+		t.Error("Should find cells after finalize")
+	}
+}
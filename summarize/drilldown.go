@@ -0,0 +1,76 @@
+package summarize
+
+// DrillDown is a summary with a summary of the tuples that satisfy each of its formulas
+type DrillDown struct {
+	SummaryResult              // the summary
+	NumTuples     int          // number of tuples that were summarized
+	Children      []*DrillDown // drill-down into every formula of the summary, nil at the maximum depth
+}
+
+// Within builds an index of the tuples that satisfy a formula of a summary, covered or not
+// cells that cover every tuple are left out because they cannot tell the tuples apart,
+// these are the cells of the formula and the hierarchy levels above them but also values and negations that the formula implies
+// tuple i of the index is the i-th tuple in Members
+func (relation *RelationIndex) Within(values []Value) *RelationIndex {
+	tuples := relation.Members(values)
+	sub := relation.subset(tuples, nil, func(cell *Cell) bool {
+		return cell.size() < len(tuples)
+	})
+	sub.SetCoverRepresentation(AutomaticCovers)
+	return sub
+}
+
+// SummarizeWithin summarizes the tuples that satisfy a formula of a summary
+func (relation *RelationIndex) SummarizeWithin(values []Value, size int) SummaryResult {
+	return relation.Within(values).Summarize(size)
+}
+
+// DrillDown summarizes the relation and recursively the tuples that satisfy each formula, up to depth levels below the summary
+// like Summarize, the tuples that the formulas of the first summary cover are covered afterwards
+// the nested summaries have no pinned values and only require the attributes that the formula above has no value of
+func (relation *RelationIndex) DrillDown(size int, depth int, options Options) *DrillDown {
+	result := relation.SummarizeWithOptions(size, options)
+	tree := DrillDown{result, relation.numTuples, nil}
+	if depth <= 0 {
+		return &tree
+	}
+	for _, values := range result.Summary {
+		tree.Children = append(tree.Children, relation.Within(values).DrillDown(size, depth-1, options.within(values)))
+	}
+	return &tree
+}
+
+// within returns the options for summaries of the tuples that satisfy a formula
+// every tuple has the pinned values so they are not in the index of these tuples and neither are the values of required attributes
+func (options Options) within(values []Value) Options {
+	options.Pinned = nil
+	var required []string
+	for _, name := range options.Required {
+		fixed := false
+		for _, value := range values {
+			if value.attributeName == name && !value.negated {
+				fixed = true
+			}
+		}
+		if !fixed {
+			required = append(required, name)
+		}
+	}
+	options.Required = required
+	return options
+}
+
+// Within builds an index of the tuples that satisfy a formula of a summary
+func (index *MappedIndex) Within(values []Value) *RelationIndex {
+	return index.relation.Within(values)
+}
+
+// SummarizeWithin summarizes the tuples that satisfy a formula of a summary
+func (index *MappedIndex) SummarizeWithin(values []Value, size int) SummaryResult {
+	return index.relation.SummarizeWithin(values, size)
+}
+
+// DrillDown summarizes the index and recursively the tuples that satisfy each formula
+func (index *MappedIndex) DrillDown(size int, depth int, options Options) *DrillDown {
+	return index.run().DrillDown(size, depth, options)
+}
@@ -0,0 +1,130 @@
+package summarize
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWithin(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,hierarchy,single\nvenue,topic,year\nSIGMOD,db systems,2015\nSIGMOD,db systems,2014\nSIGMOD,db theory,2015\nVLDB,db systems,2015\nICDE,ml,2013", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the formula and the levels above it cover every tuple and are left out
+	within := relation.Within([]Value{{hierarchy, "topic", "db/systems", false, nil}})
+	expected, err := NewIndexFromString("single,hierarchy,single\nvenue,topic,year\nSIGMOD,,2015\nSIGMOD,,2014\nVLDB,,2015", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if within.numTuples != 3 {
+		t.Error("Wrong number of tuples", within.numTuples)
+	}
+	if describeCells(within) != describeCells(expected) {
+		t.Error("Wrong cells", describeCells(within), describeCells(expected))
+	}
+
+	// negated cells of other values stay
+	relation.AddNegations(0.3)
+	within = relation.Within([]Value{{single, "venue", "SIGMOD", true, nil}})
+	for _, cell := range within.attrs[0].cells {
+		if cell.negated && cell.value() == "SIGMOD" {
+			t.Error("The negated formula cell should be left out")
+		}
+	}
+	if within.numTuples != 2 {
+		t.Error("Wrong number of tuples", within.numTuples)
+	}
+
+	// cells that the formula implies are left out, like the negation of another venue
+	negated, err := NewIndexFromString("single,single\nvenue,year\nSIGMOD,2015\nSIGMOD,2014\nSIGMOD,2013\nVLDB,2015\nVLDB,2013", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	negated.AddNegations(0.1)
+	within = negated.Within([]Value{{single, "venue", "SIGMOD", false, nil}, {single, "year", "2013", true, nil}})
+	if within.numTuples != 2 {
+		t.Error("Wrong number of tuples", within.numTuples)
+	}
+	for _, attr := range within.attrs {
+		for ic := range attr.cells {
+			if cell := &attr.cells[ic]; cell.size() == within.numTuples {
+				t.Error("Cells that cover every tuple should be left out", attr.attributeName, cell.value(), cell.negated)
+			}
+		}
+	}
+
+	// every SIGMOD tuple has the topic db so only the level below it is left
+	result := relation.SummarizeWithin([]Value{{single, "venue", "SIGMOD", false, nil}}, 1)
+	if fmt.Sprint(result.Summary) != "[[{2 topic db/systems false []}]]" || result.SummaryCover != 2 {
+		t.Error("Wrong summary within SIGMOD", result)
+	}
+
+	if empty := relation.Within([]Value{{single, "venue", "PODS", false, nil}}); empty.numTuples != 0 {
+		t.Error("Nothing satisfies a missing value", empty.numTuples)
+	}
+}
+
+func TestDrillDown(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single,single\nvenue,year,author\nSIGMOD,2015,Gray\nSIGMOD,2015,Codd\nSIGMOD,2014,Gray\nVLDB,2015,Gray\nVLDB,2013,Codd\nVLDB,2013,Codd", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Deterministic: true}
+
+	tree := relation.DrillDown(2, 2, options)
+	if tree.NumTuples != 6 || len(tree.Children) != len(tree.Summary) {
+		t.Fatal("Wrong root", tree.NumTuples, len(tree.Children))
+	}
+	for i, child := range tree.Children {
+		members := len(relation.Members(tree.Summary[i]))
+		if child.NumTuples != members {
+			t.Error("Drill-down should summarize the members of the formula", child.NumTuples, members)
+		}
+		for _, formula := range child.Summary {
+			for _, value := range formula {
+				for _, parent := range tree.Summary[i] {
+					if value.attributeName == parent.attributeName && value.value == parent.value {
+						t.Error("Drill-down should not repeat the formula", value)
+					}
+				}
+			}
+		}
+		for _, grandchild := range child.Children {
+			if grandchild.Children != nil {
+				t.Error("Drill-down should stop at the depth")
+			}
+			if grandchild.NumTuples > child.NumTuples {
+				t.Error("Drill-down should only narrow down", grandchild.NumTuples, child.NumTuples)
+			}
+		}
+	}
+}
+
+func TestDrillDownPinned(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single,single\nvenue,year,author\nSIGMOD,2015,Gray\nSIGMOD,2015,Codd\nSIGMOD,2014,Gray\nVLDB,2015,Gray\nVLDB,2015,Codd\nVLDB,2013,Codd", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Deterministic: true, Pinned: []Value{{single, "year", "2015", false, nil}}, Required: []string{"year", "venue"}}
+
+	tree := relation.DrillDown(2, 1, options)
+	if len(tree.Summary) != 2 {
+		t.Fatal("Wrong summary", tree.Summary)
+	}
+	for i, child := range tree.Children {
+		if len(child.Summary) == 0 {
+			t.Error("Pinned values should not leave the nested summaries empty", tree.Summary[i])
+		}
+		for _, formula := range child.Summary {
+			for _, value := range formula {
+				if value.attributeName == "year" || value.attributeName == "venue" {
+					t.Error("Nested summaries should not repeat the formula", formula)
+				}
+			}
+		}
+	}
+}
@@ -16,62 +16,210 @@ type Formula struct {
 	usedSingleAttributes intsets.Sparse // which single attributes are already used
 	tupleCover           TupleCovers    // how much does a tuple contribute to the formula
 	cover                float64        // how much does this formula cover, sum of valid tupleCover
+	negations            int            // how many of the cells are negated
+	tuples               []int          // tuples in tupleCover in ascending order, only set for deterministic summaries
+	pinned               int            // number of cells at the start that were pinned and must not change
+	overlap              float64        // share of the weight of a tuple that is left every time a formula covers it, 0 if tuples are covered once
 }
 
 // NewFormula creates a new formula from a cell
 func NewFormula(cell Cell) *Formula {
+	return newFormula(cell, 0)
+}
+
+// newFormula creates a new formula from a cell that counts tuples that were covered before with the given overlap
+func newFormula(cell Cell, overlap float64) *Formula {
 	var formula Formula
+	formula.overlap = overlap
+
+	formula.initTupleCover(cell)
+	formula.addCellNoUpdateValues(cell)
 
+	return &formula
+}
+
+// initTupleCover sets the tuple cover to what a single cell covers
+func (formula *Formula) initTupleCover(cell Cell) {
 	formula.tupleCover = make(TupleCovers)
 	formula.cover = 0
+	formula.tuples = nil
 
-	for tuple, cover := range cell.covers {
-		if !cover.covered {
-			formula.tupleCover[tuple] = cover.weight
-			formula.cover += cover.weight
-		} else {
-			formula.tupleCover[tuple] = 0
-		}
+	if cell.tuples != nil {
+		formula.tuples = append([]int{}, cell.tuples...)
 	}
 
-	formula.addCellNoUpdateValues(cell)
-
-	return &formula
+	for _, tuple := range cell.coveredTuples() {
+		remaining := cell.remaining(tuple, formula.overlap)
+		formula.tupleCover[tuple] = remaining
+		formula.cover += remaining
+	}
 }
 
 func (formula *Formula) addCellNoUpdateValues(cell Cell) {
 	formula.cells = append(formula.cells, cell)
 
 	// if the cell is a single, add attribute to exclude list
-	if cell.attribute.attributeType == single {
+	// negated cells do not exclude each other, "x != a and x != b" is fine
+	if cell.negated {
+		formula.negations++
+	} else if cell.attribute.attributeType == single {
 		formula.usedSingleAttributes.Insert(cell.attribute.index)
 	}
 }
 
+// disjunction returns the position of the cell that a cell would be added to as an alternative value or -1
+// only positive single cells can be combined disjunctively
+func (formula *Formula) disjunction(cell Cell) int {
+	if cell.negated || cell.attribute.attributeType != single || !formula.usedSingleAttributes.Has(cell.attribute.index) {
+		return -1
+	}
+	for i, c := range formula.cells {
+		if c.attribute.index == cell.attribute.index && !c.negated {
+			return i
+		}
+	}
+	return -1
+}
+
+// negates returns whether the formula has a negated cell for an attribute
+func (formula *Formula) negates(attribute int) bool {
+	for _, c := range formula.cells {
+		if c.negated && c.attribute.index == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// narrows returns whether the formula does not cover some tuple that it covers without the cell
+// a negation that every tuple of the formula satisfies is implied by the formula and should not add to its cover
+func (formula *Formula) narrows(cell Cell) bool {
+	if cell.size() < len(formula.tupleCover) {
+		return true
+	}
+	for tuple := range formula.tupleCover {
+		if _, _, has := cell.lookup(tuple); !has {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutImpliedNegations returns the formula without the negations that its other cells imply, pinned cells stay
+// a formula can start with a negation that a positive cell that is added later implies
+func (formula *Formula) withoutImpliedNegations() *Formula {
+	for i := formula.pinned; i < len(formula.cells) && len(formula.cells) > 1; i++ {
+		if !formula.cells[i].negated {
+			continue
+		}
+		rest := formula.without(i)
+		if !rest.narrows(formula.cells[i]) {
+			return rest.withoutImpliedNegations()
+		}
+	}
+	return formula
+}
+
+// without builds the formula again without the cell at position i
+func (formula *Formula) without(i int) *Formula {
+	cells := append(append([]Cell{}, formula.cells[:i]...), formula.cells[i+1:]...)
+	rest := newFormula(cells[0], formula.overlap)
+	for _, c := range cells[1:] {
+		rest.AddCell(c)
+	}
+	rest.pinned = formula.pinned
+	return rest
+}
+
+// pins returns whether a cell is one of the pinned cells
+func (formula *Formula) pins(cell Cell) bool {
+	for _, c := range formula.cells[:formula.pinned] {
+		if c.attribute == cell.attribute && c.id == cell.id && c.negated == cell.negated {
+			return true
+		}
+	}
+	return false
+}
+
+// lacks returns whether the formula has no positive value of one of the attributes
+func (formula *Formula) lacks(required []string) bool {
+	for _, name := range required {
+		if !formula.has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// has returns whether the formula has a positive value of an attribute
+func (formula *Formula) has(name string) bool {
+	for _, c := range formula.cells {
+		if !c.negated && c.attribute.attributeName == name {
+			return true
+		}
+	}
+	return false
+}
+
 // AddCell adds a cell to the formula and updates internals
+// if the formula already has a value for the single attribute of the cell, the value becomes an alternative
 func (formula *Formula) AddCell(cell Cell) {
+	if i := formula.disjunction(cell); i >= 0 {
+		formula.cells[i] = formula.cells[i].union(cell)
+
+		// the formula covers more tuples now so we have to start over
+		formula.initTupleCover(formula.cells[0])
+		for _, c := range formula.cells[1:] {
+			formula.intersect(c)
+		}
+		return
+	}
+
 	formula.addCellNoUpdateValues(cell)
+	formula.intersect(cell)
+}
+
+// intersect restricts the tuple cover to the tuples that a cell covers and adds the cell weights
+func (formula *Formula) intersect(cell Cell) {
+	if formula.tuples != nil {
+		// go through the tuples in order so that the cover does not depend on map iteration order
+		tuples := formula.tuples[:0]
+		for _, tuple := range formula.tuples {
+			if formula.intersectTuple(cell, tuple) {
+				tuples = append(tuples, tuple)
+			}
+		}
+		formula.tuples = tuples
+		return
+	}
 
 	// TODO: is other direction faster?
 	for tuple := range formula.tupleCover {
-		if cover, has := cell.covers[tuple]; has {
-			formula.cover += cover.weight
-			formula.tupleCover[tuple] += cover.weight
-		} else {
-			formula.cover -= formula.tupleCover[tuple]
-			delete(formula.tupleCover, tuple)
-		}
+		formula.intersectTuple(cell, tuple)
+	}
+}
+
+// intersectTuple updates the cover of a single tuple and returns whether the formula still covers it
+func (formula *Formula) intersectTuple(cell Cell, tuple int) bool {
+	if _, _, has := cell.lookup(tuple); has {
+		remaining := cell.remaining(tuple, formula.overlap)
+		formula.cover += remaining
+		formula.tupleCover[tuple] += remaining
+		return true
 	}
+	formula.cover -= formula.tupleCover[tuple]
+	delete(formula.tupleCover, tuple)
+	return false
 }
 
 // CoverIndex updates the cover so that in the next iteration the same tuples are not covered again
+// if covers overlap, the tuples count less every time they are covered
 func (formula *Formula) CoverIndex(relation *RelationIndex) {
 	// TODO: is other direction faster?
 	for _, cell := range formula.cells {
 		for tuple := range formula.tupleCover {
-			if cover, has := cell.covers[tuple]; has && !cover.covered {
-				// set uncovered to covered
-				cell.covers[tuple].covered = true
+			if _, _, has := cell.lookup(tuple); has {
+				cell.setCovered(tuple, formula.overlap > 0)
 			}
 		}
 	}
@@ -81,7 +229,7 @@ func (values TupleCovers) String() string {
 	var buffer bytes.Buffer
 	fmt.Fprintf(&buffer, "Tuple Value (%d):\n", len(values))
 	for i, values := range values {
-		fmt.Fprintf(&buffer, "%d: %d\n", i, values)
+		fmt.Fprintf(&buffer, "%d: %g\n", i, values)
 	}
 	return buffer.String()
 }
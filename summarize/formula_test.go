@@ -3,10 +3,10 @@ package summarize
 import "testing"
 
 func TestCreate(t *testing.T) {
-	y := Cover{true, 1}
-	n := Cover{false, 1}
-	attribute := Attribute{0, set, "x", nil, nil}
-	cell := Cell{TupleCover{0: &y, 1: &n}, &attribute, "a", true}
+	y := Cover{1, 1}
+	n := Cover{0, 1}
+	attribute := Attribute{0, set, "x", newDictionary(), nil, nil, nil, TimeFormat{}, false, nil}
+	cell := Cell{TupleCover{0: &y, 1: &n}, nil, &attribute, intern(&attribute, "a"), true, false, nil, nil}
 
 	formula := NewFormula(cell)
 
@@ -17,8 +17,8 @@ func TestCreate(t *testing.T) {
 		t.Error("Should not have cover")
 	}
 
-	attribute2 := Attribute{0, set, "x", nil, nil}
-	cell2 := Cell{TupleCover{1: &n, 2: &y}, &attribute2, "a", true}
+	attribute2 := Attribute{0, set, "x", newDictionary(), nil, nil, nil, TimeFormat{}, false, nil}
+	cell2 := Cell{TupleCover{1: &n, 2: &y}, nil, &attribute2, intern(&attribute2, "a"), true, false, nil, nil}
 	formula.AddCell(cell2)
 
 	if _, has := formula.tupleCover[0]; has {
@@ -31,3 +31,24 @@ func TestCreate(t *testing.T) {
 		t.Error("This should not be affected because we only shrink")
 	}
 }
+
+func TestAddDisjunct(t *testing.T) {
+	attribute := Attribute{0, single, "x", newDictionary(), nil, nil, nil, TimeFormat{}, false, nil}
+	a := Cell{TupleCover{0: &Cover{0, 1}, 1: &Cover{1, 1}}, nil, &attribute, intern(&attribute, "a"), true, false, nil, nil}
+	b := Cell{TupleCover{2: &Cover{0, 1}}, nil, &attribute, intern(&attribute, "b"), true, false, nil, nil}
+
+	formula := NewFormula(a)
+	formula.AddCell(b)
+
+	if len(formula.cells) != 1 || len(formula.cells[0].disjuncts) != 1 {
+		t.Error("Should have one disjunctive cell")
+	}
+	if len(formula.tupleCover) != 3 || formula.cover != 2 {
+		t.Error("Should cover the union", formula.tupleCover, formula.cover)
+	}
+
+	formula.CoverIndex(nil)
+	if b.covers[2].count == 0 {
+		t.Error("Covering the disjunction should cover the value")
+	}
+}
@@ -0,0 +1,457 @@
+package summarize
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// mapped snapshots start with the magic bytes, padding and the version of the format
+const mappedMagic = "SUMMAP\x00\x00"
+
+// version of the mapped snapshot format, has to change whenever the layout changes
+const mappedVersion = 1
+
+// size of the header and the trailer of a mapped snapshot
+const mappedHeaderSize = 16
+const mappedTrailerSize = 24
+
+// the arrays in a mapped snapshot are aliased in memory so they have to use the byte order of the machine
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// A mapped snapshot stores covers as arrays that can be used in place when the file is mapped into memory.
+//
+//	header: magic bytes, version as uint32, 4 bytes padding
+//	data: the arrays of the bitmaps and weights, little endian and aligned to 8 bytes
+//	metadata: varint encoded like a snapshot, with offsets into the data instead of the arrays
+//	  number of tuples, number of attributes
+//	  for every attribute: type and name
+//	  for every attribute:
+//	    time layouts and whether times have hours
+//	    offset and length of the weights
+//	    cells, for every cell: value, equal weights, negated, number of tuples, number of chunks, offset of the chunk keys
+//	      for every chunk: whether it is a bitset, number of tuples, offset of the array or bitset
+//	trailer: offset and length of the metadata as uint64, CRC-32C of the metadata and of the data as uint32
+//
+// Which tuples are covered is not part of a snapshot.
+
+// WriteMappedTo writes a snapshot of the index that OpenMappedIndex can map into memory
+func (relation *RelationIndex) WriteMappedTo(w io.Writer) (int64, error) {
+	dw := snapshotWriter{bufio.NewWriter(w), nil, 0, nil, nil}
+
+	var header [mappedHeaderSize]byte
+	copy(header[:], mappedMagic)
+	binary.LittleEndian.PutUint32(header[len(mappedMagic):], mappedVersion)
+	dw.write(header[:])
+	dw.crc = crc32.New(snapshotTable)
+
+	var metadata bytes.Buffer
+	mw := snapshotWriter{bufio.NewWriter(&metadata), nil, 0, nil, nil}
+
+	mw.uvarint(uint64(relation.numTuples))
+	mw.uvarint(uint64(len(relation.attrs)))
+	for _, attr := range relation.attrs {
+		mw.string(attr.attributeType.String())
+		mw.string(attr.attributeName)
+	}
+
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+
+		mw.uvarint(uint64(len(attr.timeFormat.Layouts)))
+		for _, layout := range attr.timeFormat.Layouts {
+			mw.string(layout)
+		}
+		mw.bool(attr.timeFormat.Hours)
+
+		weights := attr.mappedWeights()
+		mw.uvarint(uint64(dw.float64s(weights)))
+		mw.uvarint(uint64(len(weights)))
+
+		mw.uvarint(uint64(len(attr.cells)))
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+			mw.string(cell.value())
+			mw.bool(cell.equalWeights)
+			mw.bool(cell.negated)
+
+			tuples := cell.tupleBitmap()
+			mw.uvarint(uint64(tuples.n))
+			mw.uvarint(uint64(len(tuples.keys)))
+			mw.uvarint(uint64(dw.uint16s(tuples.keys)))
+			for _, chunk := range tuples.chunks {
+				mw.bool(chunk.bits != nil)
+				mw.uvarint(uint64(chunk.n))
+				if chunk.bits != nil {
+					mw.uvarint(uint64(dw.uint64s(chunk.bits)))
+				} else {
+					mw.uvarint(uint64(dw.uint16s(chunk.array)))
+				}
+			}
+		}
+	}
+
+	if mw.err == nil {
+		mw.err = mw.w.Flush()
+	}
+	if mw.err != nil {
+		return dw.n, mw.err
+	}
+
+	dw.align()
+	dataChecksum := dw.crc.Sum32()
+	dw.crc = nil
+
+	var trailer [mappedTrailerSize]byte
+	binary.LittleEndian.PutUint64(trailer[0:], uint64(dw.n))
+	binary.LittleEndian.PutUint64(trailer[8:], uint64(metadata.Len()))
+	binary.LittleEndian.PutUint32(trailer[16:], crc32.Checksum(metadata.Bytes(), snapshotTable))
+	binary.LittleEndian.PutUint32(trailer[20:], dataChecksum)
+	dw.write(metadata.Bytes())
+	dw.write(trailer[:])
+
+	if dw.err == nil {
+		dw.err = dw.w.Flush()
+	}
+	return dw.n, dw.err
+}
+
+// mappedWeights returns the weights of all tuples if any cell of the attribute has weights
+func (attr *Attribute) mappedWeights() []float64 {
+	if attr.bitmaps {
+		return attr.weights
+	}
+
+	var weights []float64
+	for ic := range attr.cells {
+		cell := &attr.cells[ic]
+		if cell.equalWeights {
+			continue
+		}
+		for tuple, cover := range cell.covers {
+			for len(weights) <= tuple {
+				weights = append(weights, 0)
+			}
+			weights[tuple] = cover.weight
+		}
+	}
+	return weights
+}
+
+// tupleBitmap returns the tuples that the cell covers as a bitmap
+func (cell *Cell) tupleBitmap() *Bitmap {
+	if cell.bitmap != nil {
+		return &cell.bitmap.tuples
+	}
+	var tuples Bitmap
+	for _, tuple := range cell.sortedTuples() {
+		tuples.Add(tuple)
+	}
+	return &tuples
+}
+
+// MappedIndex is a read-only index whose covers stay in a memory-mapped snapshot file
+// only the tuples that are covered by a summary are kept in memory, in cells that belong to that summary
+type MappedIndex struct {
+	relation RelationIndex
+	data     []byte // the mapped file
+}
+
+// OpenMappedIndex maps a snapshot that was written with WriteMappedTo into memory
+// the metadata is checked but the covers are only checked by Verify
+func OpenMappedIndex(path string) (*MappedIndex, error) {
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := newMappedIndex(data)
+	if err != nil {
+		unmapFile(data)
+		return nil, err
+	}
+	return index, nil
+}
+
+func newMappedIndex(data []byte) (*MappedIndex, error) {
+	if !littleEndian {
+		return nil, errors.New("Mapped indexes are only supported on little endian machines.")
+	}
+	if len(data) < mappedHeaderSize+mappedTrailerSize || string(data[:len(mappedMagic)]) != mappedMagic {
+		return nil, errors.New("Not a mapped index snapshot.")
+	}
+	if version := binary.LittleEndian.Uint32(data[len(mappedMagic):]); version != mappedVersion {
+		err := fmt.Sprintf("Unsupported mapped index snapshot version %d. Expected %d.", version, mappedVersion)
+		return nil, errors.New(err)
+	}
+
+	trailer := data[len(data)-mappedTrailerSize:]
+	metadataOffset := binary.LittleEndian.Uint64(trailer[0:])
+	metadataLength := binary.LittleEndian.Uint64(trailer[8:])
+	if metadataOffset < mappedHeaderSize || metadataOffset+metadataLength != uint64(len(data)-mappedTrailerSize) {
+		return nil, errCorruptSnapshot
+	}
+	metadata := data[metadataOffset : metadataOffset+metadataLength]
+	if crc32.Checksum(metadata, snapshotTable) != binary.LittleEndian.Uint32(trailer[16:]) {
+		return nil, errors.New("Mapped index snapshot checksum mismatch.")
+	}
+
+	index := MappedIndex{RelationIndex{}, data}
+	sr := snapshotReader{metadata, nil}
+
+	numTuples := int(sr.uvarint())
+	numAttrs := sr.length()
+	typeNames := make([]string, numAttrs)
+	names := make([]string, numAttrs)
+	for i := range typeNames {
+		typeNames[i] = sr.string()
+		names[i] = sr.string()
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+
+	relation, err := NewIndex(typeNames, names, numTuples)
+	if err != nil {
+		return nil, err
+	}
+
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		attr.bitmaps = true
+
+		attr.timeFormat.Layouts = make([]string, sr.length())
+		for i := range attr.timeFormat.Layouts {
+			attr.timeFormat.Layouts[i] = sr.string()
+		}
+		attr.timeFormat.Hours = sr.bool()
+
+		offset := sr.uvarint()
+		attr.weights = index.float64s(&sr, offset, sr.uvarint())
+
+		attr.cells = make([]Cell, 0, sr.length())
+		for ic := 0; ic < cap(attr.cells) && sr.err == nil; ic++ {
+			value := sr.string()
+			cell := MakeCell(attr, value, sr.bool())
+			cell.negated = sr.bool()
+
+			tuples := &cell.bitmap.tuples
+			tuples.n = int(sr.uvarint())
+			numChunks := sr.length()
+			tuples.keys = index.uint16s(&sr, sr.uvarint(), uint64(numChunks))
+			tuples.chunks = make([]bitmapChunk, numChunks)
+			total := 0
+			for i := range tuples.chunks {
+				chunk := &tuples.chunks[i]
+				bitset := sr.bool()
+				chunk.n = int(sr.uvarint())
+				if bitset {
+					chunk.bits = index.uint64s(&sr, sr.uvarint(), bitsetWords)
+				} else {
+					chunk.array = index.uint16s(&sr, sr.uvarint(), uint64(chunk.n))
+				}
+				total += chunk.n
+			}
+			if total != tuples.n {
+				sr.err = errCorruptSnapshot
+			}
+
+			attr.appendCell(cell)
+		}
+	}
+
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if len(sr.data) > 0 {
+		return nil, errCorruptSnapshot
+	}
+
+	index.relation = *relation
+	return &index, nil
+}
+
+// span returns n elements of a size at an offset of the data or nil if they are not in the data section
+func (index *MappedIndex) span(sr *snapshotReader, offset uint64, n uint64, size uint64) unsafe.Pointer {
+	if sr.err != nil || n == 0 {
+		return nil
+	}
+	end := uint64(len(index.data) - mappedTrailerSize)
+	if offset < mappedHeaderSize || offset%size != 0 || n > end/size || offset > end-n*size {
+		sr.err = errCorruptSnapshot
+		return nil
+	}
+	return unsafe.Pointer(&index.data[offset])
+}
+
+func (index *MappedIndex) uint16s(sr *snapshotReader, offset uint64, n uint64) []uint16 {
+	if p := index.span(sr, offset, n, 2); p != nil {
+		return unsafe.Slice((*uint16)(p), n)
+	}
+	return nil
+}
+
+func (index *MappedIndex) uint64s(sr *snapshotReader, offset uint64, n uint64) []uint64 {
+	if p := index.span(sr, offset, n, 8); p != nil {
+		return unsafe.Slice((*uint64)(p), n)
+	}
+	return nil
+}
+
+func (index *MappedIndex) float64s(sr *snapshotReader, offset uint64, n uint64) []float64 {
+	if p := index.span(sr, offset, n, 8); p != nil {
+		return unsafe.Slice((*float64)(p), n)
+	}
+	return nil
+}
+
+// Verify checks the covers against their checksum, this reads the whole file
+func (index *MappedIndex) Verify() error {
+	trailer := index.data[len(index.data)-mappedTrailerSize:]
+	data := index.data[mappedHeaderSize:binary.LittleEndian.Uint64(trailer[0:])]
+	if crc32.Checksum(data, snapshotTable) != binary.LittleEndian.Uint32(trailer[20:]) {
+		return errors.New("Mapped index snapshot checksum mismatch.")
+	}
+
+	// weights are looked up for every tuple of a cell with weights
+	for _, attr := range index.relation.attrs {
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+			if cell.equalWeights {
+				continue
+			}
+			it := cell.bitmap.tuples.Iterator()
+			for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+				if tuple >= len(attr.weights) {
+					return errCorruptSnapshot
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Summarize summarizes
+func (index *MappedIndex) Summarize(size int) SummaryResult {
+	return index.SummarizeWithOptions(size, DefaultOptions)
+}
+
+// SummarizeWithOptions summarizes with the given search options
+// formula candidates are not restricted to co-occurring cells because the index for this would not fit in memory
+func (index *MappedIndex) SummarizeWithOptions(size int, options Options) SummaryResult {
+	relation := index.run()
+	result, _ := relation.summarize(context.Background(), size, options, false, nil)
+	return result
+}
+
+// SummarizeContext summarizes until the summary is complete or the context is done
+func (index *MappedIndex) SummarizeContext(ctx context.Context, size int, options Options) (SummaryResult, error) {
+	relation := index.run()
+	return relation.summarize(ctx, size, options, false, nil)
+}
+
+// Reset does nothing because every summary of a mapped index starts without covered tuples
+func (index *MappedIndex) Reset() {
+}
+
+// run returns a copy of the index for one summary, its cells share the tuples in the mapped file but have their own covered tuples
+// so summaries of the same index can run concurrently
+func (index *MappedIndex) run() *RelationIndex {
+	relation := index.relation
+	relation.attrs = make([]Attribute, len(index.relation.attrs))
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		*attr = index.relation.attrs[ia]
+		attr.cells = make([]Cell, len(attr.cells))
+		for ic, cell := range index.relation.attrs[ia].cells {
+			cell.attribute = attr
+			cell.bitmap = &bitmapCover{cell.bitmap.tuples, Bitmap{}, nil, nil}
+			cell.tuples = nil
+			attr.cells[ic] = cell
+		}
+	}
+	return &relation
+}
+
+// NumTuples returns the number of tuples
+func (index *MappedIndex) NumTuples() int {
+	return index.relation.numTuples
+}
+
+// Close unmaps the file, the index cannot be used afterwards
+func (index *MappedIndex) Close() error {
+	data := index.data
+	index.data = nil
+	index.relation = RelationIndex{}
+	if data == nil {
+		return nil
+	}
+	return unmapFile(data)
+}
+
+func (index *MappedIndex) String() string {
+	return index.relation.String()
+}
+
+// align pads what was written to a multiple of 8 bytes
+func (sw *snapshotWriter) align() {
+	var padding [8]byte
+	if rest := sw.n % 8; rest != 0 {
+		sw.write(padding[:8-rest])
+	}
+}
+
+// uint16s writes aligned values and returns their offset, 0 for no values
+func (sw *snapshotWriter) uint16s(xs []uint16) int64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sw.align()
+	offset := sw.n
+	buf := sw.bytes(2 * len(xs))
+	for i, x := range xs {
+		binary.LittleEndian.PutUint16(buf[2*i:], x)
+	}
+	sw.write(buf)
+	return offset
+}
+
+// uint64s writes aligned values and returns their offset, 0 for no values
+func (sw *snapshotWriter) uint64s(xs []uint64) int64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sw.align()
+	offset := sw.n
+	buf := sw.bytes(8 * len(xs))
+	for i, x := range xs {
+		binary.LittleEndian.PutUint64(buf[8*i:], x)
+	}
+	sw.write(buf)
+	return offset
+}
+
+// float64s writes aligned values and returns their offset, 0 for no values
+func (sw *snapshotWriter) float64s(xs []float64) int64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sw.align()
+	offset := sw.n
+	buf := sw.bytes(8 * len(xs))
+	for i, x := range xs {
+		binary.LittleEndian.PutUint64(buf[8*i:], math.Float64bits(x))
+	}
+	sw.write(buf)
+	return offset
+}
@@ -0,0 +1,146 @@
+package summarize
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func writeMapped(t *testing.T, relation *RelationIndex) string {
+	path := filepath.Join(t.TempDir(), "index.map")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := relation.WriteMappedTo(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMappedIndex(t *testing.T) {
+	options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		for _, assessor := range []Assessor{MakeEqualWeightAssessor(), MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})} {
+			relation, err := NewIndexFromString(partitionDescription, assessor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			relation.SetCoverRepresentation(representation)
+			relation.AddNegations(0.3)
+
+			index, err := OpenMappedIndex(writeMapped(t, relation))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := index.Verify(); err != nil {
+				t.Error(err)
+			}
+			if index.NumTuples() != relation.numTuples {
+				t.Error("Wrong number of tuples", index.NumTuples())
+			}
+
+			for _, summarizer := range []Summarizer{relation, index} {
+				expected := fmt.Sprintf("%v", relation.SummarizeWithOptions(5, options))
+				relation.Reset()
+				actual := fmt.Sprintf("%v", summarizer.SummarizeWithOptions(5, options))
+				summarizer.Reset()
+				if actual != expected {
+					t.Error("Mapped index should give the same summary", expected, actual)
+				}
+			}
+
+			if err := index.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
+
+func TestMappedIndexLarge(t *testing.T) {
+	relation := makeRandomRelation(100000, BitmapCovers)
+	index, err := OpenMappedIndex(writeMapped(t, relation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	// covers of this size use bitset chunks
+	expected := relation.Summarize(3)
+	actual := index.Summarize(3)
+	if expected.SummaryCover != actual.SummaryCover {
+		t.Error("Mapped index should give the same cover", expected.SummaryCover, actual.SummaryCover)
+	}
+}
+
+func TestMappedIndexConcurrent(t *testing.T) {
+	relation := makeRandomRelation(5000, BitmapCovers)
+	index, err := OpenMappedIndex(writeMapped(t, relation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+	expected := fmt.Sprint(relation.SummarizeWithOptions(5, options))
+
+	// summaries do not cover the mapped index, so they can run at the same time and need no reset
+	results := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = fmt.Sprint(index.SummarizeWithOptions(5, options))
+		}(i)
+	}
+	wg.Wait()
+	results = append(results, fmt.Sprint(index.SummarizeWithOptions(5, options)))
+	for _, actual := range results {
+		if actual != expected {
+			t.Error("Concurrent summaries should give the same summary", expected, actual)
+		}
+	}
+}
+
+func TestMappedIndexErrors(t *testing.T) {
+	relation, err := NewIndexFromString(partitionDescription, MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeMapped(t, relation)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := func(offset int) string {
+		corrupted := append([]byte{}, data...)
+		corrupted[offset] ^= 1
+		path := filepath.Join(t.TempDir(), "corrupt.map")
+		if err := ioutil.WriteFile(path, corrupted, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	if _, err := OpenMappedIndex(corrupt(0)); err == nil {
+		t.Error("Should reject other files")
+	}
+	if _, err := OpenMappedIndex(corrupt(len(data) - mappedTrailerSize - 1)); err == nil {
+		t.Error("Should reject corrupt metadata")
+	}
+
+	index, err := OpenMappedIndex(corrupt(mappedHeaderSize + 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if index.Verify() == nil {
+		t.Error("Should detect corrupt covers")
+	}
+}
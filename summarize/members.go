@@ -0,0 +1,148 @@
+package summarize
+
+import "sort"
+
+// Members returns the tuples that satisfy a formula of a summary in ascending order, covered or not
+// it only reads the tuples of the cells, so it may run while the index is summarized
+func (relation *RelationIndex) Members(values []Value) []int {
+	var members []int
+	for i, value := range values {
+		tuples, has := relation.valueTuples(value)
+		if !has {
+			// nothing satisfies a value that is not in the index
+			return nil
+		}
+		if i == 0 {
+			members = tuples
+			continue
+		}
+		both := members[:0]
+		for a, b := 0, 0; a < len(members) && b < len(tuples); {
+			switch {
+			case members[a] < tuples[b]:
+				a++
+			case members[a] > tuples[b]:
+				b++
+			default:
+				both = append(both, members[a])
+				a++
+				b++
+			}
+		}
+		members = both
+	}
+	return members
+}
+
+// valueTuples returns the tuples that have a value of a summary in ascending order, false if the value is not in the index
+// unlike findValue it does not copy the cells, whose covered tuples a summary may change meanwhile
+func (relation *RelationIndex) valueTuples(value Value) ([]int, bool) {
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		if attr.attributeName != value.attributeName {
+			continue
+		}
+
+		var tuples Bitmap
+		has := false
+		add := func(idx int) {
+			if idx < 0 {
+				return
+			}
+			has = true
+			cell := &attr.cells[idx]
+			if cell.bitmap != nil {
+				tuples = *tuples.Or(&cell.bitmap.tuples)
+				return
+			}
+			for tuple := range cell.covers {
+				tuples.Add(tuple)
+			}
+		}
+		if value.negated {
+			add(attr.findNegated(value.value))
+		} else {
+			add(attr.find(value.value))
+		}
+		for _, disjunct := range value.disjuncts {
+			add(attr.find(disjunct))
+		}
+		if !has {
+			return nil, false
+		}
+
+		members := make([]int, 0, tuples.Len())
+		it := tuples.Iterator()
+		for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+			members = append(members, tuple)
+		}
+		return members, true
+	}
+	return nil, false
+}
+
+// formula builds the formula for the values of a summary, false if a value is not in the index
+// tuples that were covered before count with the given overlap
+func (relation *RelationIndex) formula(values []Value, overlap float64) (*Formula, bool) {
+	var cells []Cell
+	for _, value := range values {
+		cell, has := relation.findValue(value)
+		if !has {
+			// nothing satisfies a value that is not in the index
+			return nil, false
+		}
+		cells = append(cells, cell)
+	}
+	if len(cells) == 0 {
+		return nil, false
+	}
+
+	// the cover does not depend on the order of the cells but starting with the smallest cell is faster
+	sort.SliceStable(cells, func(a, b int) bool {
+		return cells[a].size() < cells[b].size()
+	})
+	formula := newFormula(cells[0], overlap)
+	for _, cell := range cells[1:] {
+		formula.AddCell(cell)
+	}
+	return formula, true
+}
+
+// findValue returns the cell for a value of a summary, alternative values are combined into one cell
+func (relation *RelationIndex) findValue(value Value) (Cell, bool) {
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		if attr.attributeName != value.attributeName {
+			continue
+		}
+
+		cell, has := attr.findCell(value.value, value.negated)
+		for _, disjunct := range value.disjuncts {
+			other, hasOther := attr.findCell(disjunct, false)
+			if !hasOther {
+				continue
+			}
+			if !has {
+				cell, has = other, true
+				continue
+			}
+			cell = cell.union(other)
+		}
+		return cell, has
+	}
+	return Cell{}, false
+}
+
+// findCell returns the cell for a value that may be negated
+func (attr *Attribute) findCell(value string, negated bool) (Cell, bool) {
+	if !negated {
+		if idx := attr.find(value); idx >= 0 {
+			return attr.cells[idx], true
+		}
+		return Cell{}, false
+	}
+	if idx := attr.findNegated(value); idx >= 0 {
+		return attr.cells[idx], true
+	}
+	return Cell{}, false
+}
@@ -0,0 +1,61 @@
+package summarize
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMembers(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single,set\nvenue,year,tags\nSIGMOD,2015,db ml\nSIGMOD,2014,db\nVLDB,2015,db\nICDE,2015,ml", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relation.AddNegations(0.3)
+
+	tests := []struct {
+		formula []Value
+		members string
+	}{
+		{[]Value{{single, "venue", "SIGMOD", false, nil}}, "[0 1]"},
+		{[]Value{{single, "venue", "SIGMOD", false, []string{"VLDB"}}, {set, "tags", "db", false, nil}}, "[0 1 2]"},
+		{[]Value{{single, "year", "2015", false, nil}, {single, "venue", "SIGMOD", true, nil}}, "[2 3]"},
+		{[]Value{{single, "venue", "PODS", false, nil}}, "[]"},
+	}
+	for _, test := range tests {
+		if members := fmt.Sprint(relation.Members(test.formula)); members != test.members {
+			t.Error("Wrong members", test.formula, members)
+		}
+	}
+
+	// covered tuples are still members
+	relation.Summarize(2)
+	if members := fmt.Sprint(relation.Members(tests[0].formula)); members != "[0 1]" {
+		t.Error("Covered tuples should be members", members)
+	}
+}
+
+func TestMembersDuringSummary(t *testing.T) {
+	relation := makeRandomRelation(5000, BitmapCovers)
+	options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+	formula := relation.SummarizeWithOptions(1, options).Summary[0]
+	expected := fmt.Sprint(relation.Members(formula))
+	relation.Reset()
+
+	// members do not read what the summary covers, so they may run at the same time
+	done := make(chan bool)
+	go func() {
+		relation.SummarizeWithOptions(5, options)
+		done <- true
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if members := fmt.Sprint(relation.Members(formula)); members != expected {
+			t.Fatal("Members should not change during a summary", members, expected)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package summarize
+
+import "io/ioutil"
+
+// mapFile reads a file into memory where memory-mapped files are not supported
+func mapFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+// unmapFile releases a file that was read with mapFile
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package summarize
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mapFile maps a file into memory read-only
+func mapFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, errors.New("Cannot map an empty file.")
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile unmaps a file that was mapped with mapFile
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
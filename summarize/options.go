@@ -0,0 +1,41 @@
+package summarize
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Options configure how a summary is searched
+type Options struct {
+	MaxNegations  int      // how many negated cells a formula may include, 0 disables negated cells
+	MaxDisjuncts  int      // how many values of a single attribute a formula may combine disjunctively, 0 or 1 disables disjunctions
+	Deterministic bool     // iterate over tuples in a stable order so that the same input always gives the same summary
+	TieBreak      TieBreak // which cells are preferred when they cover the same
+	Workers       int      // number of goroutines that evaluate cells when growing a formula, 0 or 1 is sequential
+	Pinned        []Value  // values that every formula includes, the summary is empty if a value is not in the index
+	Required      []string // attributes that every formula has a positive value of
+	Overlap       float64  // share of the weight of a tuple that is left every time a formula covers it, between 0 and 1, 0 covers tuples only once
+	Alternatives  int      // how many of the next best formulas that the search considered are returned for each formula, 0 returns none
+}
+
+// DefaultOptions are used by Summarize
+var DefaultOptions = Options{
+	0,
+	1,
+	false,
+	TieBreak{false, nil},
+	1,
+	nil,
+	nil,
+	0,
+	0,
+}
+
+// Check returns an error if the options are invalid
+func (options Options) Check() error {
+	if options.Overlap < 0 || options.Overlap >= 1 {
+		err := fmt.Sprintf("Invalid overlap %g. Expected at least 0 and less than 1.", options.Overlap)
+		return errors.New(err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package summarize
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// number of partitions per worker when the rows are split automatically, more partitions balance the load better
+const partitionsPerWorker = 4
+
+// longest line that NewIndexFromReader accepts
+const maxLineLength = 16 * 1024 * 1024
+
+// Partition is a part of the rows of a relation, every row has a raw value for every attribute
+type Partition [][]string
+
+// NewIndexFromPartitions creates a relation index from partitions of the rows
+// every partition is indexed on its own by one of the workers and the indexes are merged
+// tuples are numbered in the order of the partitions so the index is the same as if the rows were added one by one
+func NewIndexFromPartitions(typeNames []string, names []string, partitions []Partition, assessor Assessor, workers int) (*RelationIndex, error) {
+	numTuples := 0
+	offsets := make([]int, len(partitions))
+	for i, partition := range partitions {
+		offsets[i] = numTuples
+		numTuples += len(partition)
+	}
+
+	return newPartitionedIndex(typeNames, names, offsets, numTuples, assessor, workers, func(p int, shard *RelationIndex, assessor Assessor) error {
+		for tuple, row := range partitions[p] {
+			if err := shard.addRow(row, tuple, assessor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NewIndexFromSeparatedPartitions is like NewIndexFromPartitions but sets and hierarchies are split at a separator instead of spaces
+// values of sets and levels of hierarchies can then have spaces, like the names of authors
+func NewIndexFromSeparatedPartitions(typeNames []string, names []string, partitions []Partition, separator string, assessor Assessor, workers int) (*RelationIndex, error) {
+	numTuples := 0
+	offsets := make([]int, len(partitions))
+	for i, partition := range partitions {
+		offsets[i] = numTuples
+		numTuples += len(partition)
+	}
+
+	return newPartitionedIndex(typeNames, names, offsets, numTuples, assessor, workers, func(p int, shard *RelationIndex, assessor Assessor) error {
+		for tuple, row := range partitions[p] {
+			if len(row) != len(shard.attrs) {
+				err := fmt.Sprintf("Wrong number of attributes. Expected %d but got %d.", len(shard.attrs), len(row))
+				return errors.New(err)
+			}
+			for ia, value := range row {
+				if err := shard.attrs[ia].addColumnValue(value, separator, tuple, assessor); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// NewIndexFromReader creates a relation index from text in the same format as NewIndexFromString
+// the rows are split into partitions that are parsed and indexed on multiple workers
+func NewIndexFromReader(reader io.Reader, assessor Assessor, workers int) (*RelationIndex, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) < 2 {
+		return nil, errors.New("Missing attribute types or names.")
+	}
+
+	typeNames := strings.Split(lines[0], ",")
+	names := strings.Split(lines[1], ",")
+	rows := lines[2:]
+
+	if workers < 1 {
+		workers = 1
+	}
+	numPartitions := workers * partitionsPerWorker
+	size := (len(rows) + numPartitions - 1) / numPartitions
+
+	var offsets []int
+	for offset := 0; offset < len(rows); offset += size {
+		offsets = append(offsets, offset)
+	}
+
+	return newPartitionedIndex(typeNames, names, offsets, len(rows), assessor, workers, func(p int, shard *RelationIndex, assessor Assessor) error {
+		for tuple := 0; tuple < shard.numTuples; tuple++ {
+			if err := shard.addRow(strings.Split(rows[offsets[p]+tuple], ","), tuple, assessor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// newPartitionedIndex builds an index for every partition on workers and merges them
+// the partitions start at the offsets, fill adds the rows of a partition with tuples that start at 0
+func newPartitionedIndex(typeNames []string, names []string, offsets []int, numTuples int, assessor Assessor, workers int, fill func(p int, shard *RelationIndex, assessor Assessor) error) (*RelationIndex, error) {
+	relation, err := NewIndex(typeNames, names, numTuples)
+	if err != nil {
+		return nil, err
+	}
+
+	assessor.NumTuples = numTuples
+	if workers < 1 {
+		workers = 1
+	}
+
+	shards := make([]*RelationIndex, len(offsets))
+	errs := make([]error, len(offsets))
+	parallel(len(offsets), workers, func(p int) {
+		end := numTuples
+		if p+1 < len(offsets) {
+			end = offsets[p+1]
+		}
+
+		// the shard uses the same cover representation as the relation
+		shard, _ := NewIndex(typeNames, names, numTuples)
+		shard.numTuples = end - offsets[p]
+
+		// weights depend on the position of the tuple in the relation
+		shardAssessor := assessor
+		shardAssessor.offset = offsets[p]
+
+		errs[p] = fill(p, shard, shardAssessor)
+		shards[p] = shard
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// attributes are independent so they can be merged concurrently
+	parallel(len(relation.attrs), workers, func(ia int) {
+		parts := make([]*Attribute, len(shards))
+		for p, shard := range shards {
+			parts[p] = &shard.attrs[ia]
+		}
+		relation.attrs[ia].merge(parts, offsets)
+	})
+
+	return relation, nil
+}
+
+// merge adds the cells of the same attribute from the indexes of partitions, the tuples of a partition start at its offset
+// values get the position of their first occurrence so that cells are in the same order as if they were added one by one
+func (attr *Attribute) merge(parts []*Attribute, offsets []int) {
+	// allocate the weights once rather than growing them tuple by tuple
+	numWeights := 0
+	for p, part := range parts {
+		if len(part.weights) > 0 {
+			numWeights = offsets[p] + len(part.weights)
+		}
+	}
+	if numWeights > 0 {
+		attr.weights = make([]float64, 0, numWeights)
+	}
+
+	for p, part := range parts {
+		for ic := range part.cells {
+			cell := &part.cells[ic]
+
+			idx := attr.find(cell.value())
+			if idx < 0 {
+				idx = len(attr.cells)
+				attr.appendCell(MakeCell(attr, cell.value(), cell.equalWeights))
+			}
+			merged := &attr.cells[idx]
+
+			if cell.bitmap != nil {
+				it := cell.bitmap.tuples.Iterator()
+				for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+					merged.add(tuple+offsets[p], cell.weight(tuple))
+				}
+				continue
+			}
+			for tuple, cover := range cell.covers {
+				merged.covers[tuple+offsets[p]] = cover
+			}
+		}
+	}
+}
+
+// parallel calls f for 0 to n-1 on workers
+func parallel(n int, workers int, f func(i int)) {
+	var wg sync.WaitGroup
+	next := int64(-1)
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(atomic.AddInt64(&next, 1)); i < n; i = int(atomic.AddInt64(&next, 1)) {
+				f(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,144 @@
+package summarize
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const partitionDescription = "single,single,set,hierarchy,time\nw,x,y,z,t\na,b,c d f,a b c,2015-01-02\na,b,c,a b,2015-02-03\na,b,c,a b c,2016-01-02\nb,,d e f,a b,\na,b,c e,,2015-01-03\na,a,,a,2014-12-30\nc,d,f d,a c,2016-05-06\nc,a,e,b,2016-05-07\nb,d,c f,a c,2015-01-01"
+
+func TestPartitions(t *testing.T) {
+	lines := strings.Split(partitionDescription, "\n")
+	typeNames := strings.Split(lines[0], ",")
+	names := strings.Split(lines[1], ",")
+
+	var partitions []Partition
+	for i, line := range lines[2:] {
+		if i%4 == 0 {
+			partitions = append(partitions, nil)
+		}
+		partitions[len(partitions)-1] = append(partitions[len(partitions)-1], strings.Split(line, ","))
+	}
+
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		build := func(partitioned bool) (*RelationIndex, error) {
+			assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})
+			if partitioned {
+				return NewIndexFromPartitions(typeNames, names, partitions, assessor, 2)
+			}
+			return NewIndexFromString(partitionDescription, assessor)
+		}
+
+		expected, err := build(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := build(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected.SetCoverRepresentation(representation)
+		actual.SetCoverRepresentation(representation)
+
+		for ia, attr := range expected.attrs {
+			if len(attr.cells) != len(actual.attrs[ia].cells) {
+				t.Fatal("Wrong number of cells", attr.attributeName, len(actual.attrs[ia].cells))
+			}
+			for ic := range attr.cells {
+				cell := &attr.cells[ic]
+				other := &actual.attrs[ia].cells[ic]
+				if cell.value() != other.value() || cell.size() != other.size() {
+					t.Error("Cells should be in the same order", cell.value(), other.value())
+				}
+				if math.Abs(cell.SumWeights()-other.SumWeights()) > 1e-9 {
+					t.Error("Wrong weights", cell.value(), cell.SumWeights(), other.SumWeights())
+				}
+			}
+		}
+
+		options := Options{MaxDisjuncts: 2, Deterministic: true}
+		if fmt.Sprintf("%v", expected.SummarizeWithOptions(5, options)) != fmt.Sprintf("%v", actual.SummarizeWithOptions(5, options)) {
+			t.Error("Partitioned index should give the same summary")
+		}
+	}
+}
+
+func TestSeparatedPartitions(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	partitions := []Partition{
+		{{"SIGMOD", "Jim Gray|Mike Stonebraker", "db|query optimization"}},
+		{{"VLDB", " Jim Gray | ", "db"}, {"ICDE", "", ""}},
+	}
+	relation, err := NewIndexFromSeparatedPartitions([]string{"single", "set", "hierarchy"}, []string{"venue", "authors", "topic"}, partitions, "|", assessor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := NewIndexFromString("single,set,hierarchy\nvenue,authors,topic\nSIGMOD,Jim_Gray Mike_Stonebraker,db query_optimization\nVLDB,Jim_Gray,db\nICDE,,", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if describeCells(relation) != strings.Replace(describeCells(expected), "_", " ", -1) {
+		t.Error("Values should be split at the separator", describeCells(relation))
+	}
+
+	if _, err := NewIndexFromSeparatedPartitions([]string{"single"}, []string{"venue"}, []Partition{{{"a", "b"}}}, "|", assessor, 1); err == nil {
+		t.Error("Should fail for the wrong number of values")
+	}
+}
+
+func TestIndexFromReader(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	expected, err := NewIndexFromString(partitionDescription, assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cover := expected.Summarize(3).SummaryCover
+
+	for _, workers := range []int{0, 1, 3, 20} {
+		actual, err := NewIndexFromReader(strings.NewReader(partitionDescription+"\n"), assessor, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual.numTuples != expected.numTuples {
+			t.Error("Wrong number of tuples", actual.numTuples)
+		}
+		if actual.Summarize(3).SummaryCover != cover {
+			t.Error("Wrong summary with workers", workers)
+		}
+	}
+
+	_, err = NewIndexFromReader(strings.NewReader("single,single\nx,y\na,b\na"), assessor, 2)
+	if err == nil {
+		t.Error("Should fail for rows with the wrong number of attributes")
+	}
+}
+
+func benchmarkIndexFromReader(b *testing.B, workers int) {
+	random := rand.New(rand.NewSource(42))
+	var buffer bytes.Buffer
+	buffer.WriteString("single,single,set\ns0,s1,set0\n")
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&buffer, "%d,%d,%d %d %d\n", random.Intn(100), random.Intn(1000), random.Intn(200), random.Intn(200), random.Intn(200))
+	}
+	description := buffer.String()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewIndexFromReader(strings.NewReader(description), MakeEqualWeightAssessor(), workers); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndexFromReader(b *testing.B) {
+	benchmarkIndexFromReader(b, 1)
+}
+
+func BenchmarkIndexFromReaderParallel(b *testing.B) {
+	benchmarkIndexFromReader(b, runtime.NumCPU())
+}
@@ -3,6 +3,8 @@ package summarize
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 // RankedCell is a cell pointer and a priority
@@ -12,6 +14,48 @@ type RankedCell struct {
 	potential    float64 // potential is what the cell can cover in the whole relation or in the context of a formula, constraint: potential must always be higher than actual cover
 	maxPotential float64 // the maximum potential that the cell can have in the context of a formula, can be used to reset potential
 	index        int     // The index of the item in the heap.
+	order        int     // position of the cell when potentials are tied, makes the order total
+}
+
+// TieBreak decides which of two cells with the same potential is preferred
+type TieBreak struct {
+	Specific bool      // prefer specific over general levels of the same hierarchy
+	Weights  []float64 // prefer attributes with higher weights, by attribute index, ignored if empty
+}
+
+// less returns whether c1 is preferred over c2
+// ties are broken by weight, hierarchy level, attribute, value and then the order in which the cells were added
+func (tieBreak TieBreak) less(c1 *Cell, c2 *Cell) bool {
+	a1 := c1.attribute
+	a2 := c2.attribute
+
+	if w1, w2 := tieBreak.weight(a1), tieBreak.weight(a2); w1 != w2 {
+		return w1 > w2
+	}
+
+	if a1.index == a2.index && a1.attributeType.hierarchical() {
+		d1 := strings.Count(c1.value(), "/")
+		d2 := strings.Count(c2.value(), "/")
+		if d1 != d2 {
+			if tieBreak.Specific {
+				return d1 > d2
+			}
+			return d1 < d2
+		}
+	}
+
+	if a1.index != a2.index {
+		return a1.index < a2.index
+	}
+	return c1.value() < c2.value()
+}
+
+// weight returns the weight of an attribute or 0 if there is none
+func (tieBreak TieBreak) weight(attribute *Attribute) float64 {
+	if attribute.index < len(tieBreak.Weights) {
+		return tieBreak.Weights[attribute.index]
+	}
+	return 0
 }
 
 // CellHeap is a heap of ranked cells
@@ -27,19 +71,28 @@ func (cells CellHeap) Swap(i, j int) {
 	cells[j].index = j
 }
 
-// Less is part of sort.Interface. Sort by Potential.
+// Less is part of sort.Interface. Sort by Potential and break ties with the precomputed order.
 func (cells CellHeap) Less(i, j int) bool {
 	p1 := cells[i]
 	p2 := cells[j]
 	if p1.potential == p2.potential {
-		if p1.cell.attribute.index == p2.cell.attribute.index && p1.cell.attribute.attributeType == hierarchy && p2.cell.attribute.attributeType == hierarchy {
-			// prefer shorter hierarchies
-			return len(cells[i].cell.value) < len(cells[i].cell.value)
-		}
+		return p1.order < p2.order
 	}
 	return p1.potential > p2.potential
 }
 
+// rank sets the order of the cells that is used when potentials are tied
+func (cells CellHeap) rank(tieBreak TieBreak) {
+	ranked := make(CellHeap, len(cells))
+	copy(ranked, cells)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return tieBreak.less(ranked[i].cell, ranked[j].cell)
+	})
+	for order, cell := range ranked {
+		cell.order = order
+	}
+}
+
 // Push pushes
 func (cells *CellHeap) Push(x interface{}) {
 	n := len(*cells)
@@ -70,7 +123,7 @@ func (cells CellHeap) Valid(i int) bool {
 	j2 := 2*i + 2
 	if j1 < n {
 		if cells.Less(j1, i) {
-			panic(fmt.Sprintf("heap invariant invalidated [%d] = %d > [%d] = %d", i, cells[i], j1, cells[j1]))
+			panic(fmt.Sprintf("heap invariant invalidated [%d] = %s > [%d] = %s", i, cells[i], j1, cells[j1]))
 		}
 		if !cells.Valid(j1) {
 			return false
@@ -78,7 +131,7 @@ func (cells CellHeap) Valid(i int) bool {
 	}
 	if j2 < n {
 		if cells.Less(j2, i) {
-			panic(fmt.Sprintf("heap invariant invalidated [%d] = %d > [%d] = %d", i, cells[i], j1, cells[j2]))
+			panic(fmt.Sprintf("heap invariant invalidated [%d] = %s > [%d] = %s", i, cells[i], j2, cells[j2]))
 		}
 		if !cells.Valid(j2) {
 			return false
@@ -90,13 +143,44 @@ func (cells CellHeap) Valid(i int) bool {
 
 // recomputes how much the tuple covers
 // returns the potential
-func (cell *RankedCell) recomputeCoverage() float64 {
+// tuples that were covered before count with the given overlap
+func (cell *RankedCell) recomputeCoverage(overlap float64) float64 {
 	cell.potential = 0
 
-	for _, cover := range cell.cell.covers {
-		if !cover.covered {
-			cell.potential += cover.weight
+	if cell.cell.tuples != nil {
+		for _, tuple := range cell.cell.tuples {
+			cell.potential += cell.cell.remaining(tuple, overlap)
 		}
+		return cell.potential
+	}
+
+	attr := cell.cell.attribute
+	if bitmap := cell.cell.bitmap; bitmap != nil {
+		if cell.cell.equalWeights {
+			// covered tuples are a subset of the tuples
+			cell.potential = float64(bitmap.tuples.Len() - bitmap.covered.Len())
+			if overlap > 0 {
+				it := bitmap.covered.Iterator()
+				for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+					cell.potential += discount(bitmap.count(tuple), overlap)
+				}
+			}
+			return cell.potential
+		}
+		weights := attr.weights
+		it := bitmap.tuples.Iterator()
+		for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+			if !bitmap.covered.Contains(tuple) {
+				cell.potential += weights[tuple]
+			} else if overlap > 0 {
+				cell.potential += weights[tuple] * discount(bitmap.count(tuple), overlap)
+			}
+		}
+		return cell.potential
+	}
+
+	for _, cover := range cell.cell.covers {
+		cell.potential += cover.weight * discount(cover.count, overlap)
 	}
 
 	return cell.potential
@@ -109,20 +193,57 @@ func (cell *RankedCell) recomputeFormulaCoverage(formula *Formula) float64 {
 
 	formulaCover := 0.0     // what we cover in the whole formula
 	cell.maxPotential = 0.0 // what the cell can cover at most
+	overlap := formula.overlap
 
 	// compute cover in intersection, loops over smaller list
 	// doing this optimizations saves about 25% time
-	if len(formula.tupleCover) <= len(cell.cell.covers) {
+	if formula.tuples != nil && cell.cell.tuples != nil {
+		// merge the sorted lists so that the sums do not depend on map iteration order
+		i, j := 0, 0
+		for i < len(formula.tuples) && j < len(cell.cell.tuples) {
+			tuple := formula.tuples[i]
+			switch {
+			case tuple < cell.cell.tuples[j]:
+				i++
+			case tuple > cell.cell.tuples[j]:
+				j++
+			default:
+				formulaCover += formula.tupleCover[tuple]
+				remaining := cell.cell.remaining(tuple, overlap)
+				cell.maxPotential += remaining
+				formulaCover += remaining
+				i++
+				j++
+			}
+		}
+	} else if bitmap := cell.cell.bitmap; bitmap != nil && len(formula.tupleCover) <= bitmap.tuples.Len() {
+		for tuple, tupleCover := range formula.tupleCover {
+			if bitmap.tuples.Contains(tuple) {
+				formulaCover += tupleCover
+				remaining := cell.cell.weight(tuple) * discount(bitmap.count(tuple), overlap)
+				cell.maxPotential += remaining
+				formulaCover += remaining
+			}
+		}
+	} else if bitmap != nil {
+		it := bitmap.tuples.Iterator()
+		for tuple, ok := it.Next(); ok; tuple, ok = it.Next() {
+			if tupleCover, has := formula.tupleCover[tuple]; has {
+				formulaCover += tupleCover
+				remaining := cell.cell.weight(tuple) * discount(bitmap.count(tuple), overlap)
+				cell.maxPotential += remaining
+				formulaCover += remaining
+			}
+		}
+	} else if len(formula.tupleCover) <= len(cell.cell.covers) {
 		for tuple, tupleCover := range formula.tupleCover {
 			cover, has := cell.cell.covers[tuple]
 			if has {
 				formulaCover += tupleCover
-				// no conflict
-				if !cover.covered {
-					// and cell is not yet covered, great
-					cell.maxPotential += cover.weight
-					formulaCover += cover.weight
-				}
+				// no conflict, what the cell still adds if it is not yet covered
+				remaining := cover.weight * discount(cover.count, overlap)
+				cell.maxPotential += remaining
+				formulaCover += remaining
 			}
 		}
 	} else {
@@ -130,12 +251,10 @@ func (cell *RankedCell) recomputeFormulaCoverage(formula *Formula) float64 {
 			tupleCover, has := formula.tupleCover[tuple]
 			if has {
 				formulaCover += tupleCover
-				// no conflict
-				if !cover.covered {
-					// and cell is not yet covered, great
-					cell.maxPotential += cover.weight
-					formulaCover += cover.weight
-				}
+				// no conflict, what the cell still adds if it is not yet covered
+				remaining := cover.weight * discount(cover.count, overlap)
+				cell.maxPotential += remaining
+				formulaCover += remaining
 			}
 		}
 	}
@@ -145,7 +264,49 @@ func (cell *RankedCell) recomputeFormulaCoverage(formula *Formula) float64 {
 	cell.potential = formulaCover - formula.cover
 
 	if cell.potential-before > 0.00001 {
-		panic(fmt.Sprintf("Coverage can only decrease. Before %v, after:", before, cell.potential))
+		panic(fmt.Sprintf("Coverage can only decrease. Before %v, after: %v", before, cell.potential))
+	}
+
+	return cell.potential
+}
+
+// recomputes what this cell adds if it becomes an alternative value of the formula cell at position i
+// returns the potential
+func (cell *RankedCell) recomputeDisjunctionCoverage(formula *Formula, i int) float64 {
+	before := cell.potential
+
+	gain := 0.0
+	for _, tuple := range cell.cell.coveredTuples() {
+		if _, _, has := formula.cells[i].lookup(tuple); has {
+			continue
+		}
+
+		// the tuple has to satisfy all other cells of the formula
+		tupleCover := cell.cell.remaining(tuple, formula.overlap)
+		satisfied := true
+		for j := range formula.cells {
+			if j == i {
+				continue
+			}
+			_, _, has := formula.cells[j].lookup(tuple)
+			if !has {
+				satisfied = false
+				break
+			}
+			tupleCover += formula.cells[j].remaining(tuple, formula.overlap)
+		}
+
+		if satisfied {
+			gain += tupleCover
+		}
+	}
+
+	// adding an alternative value only ever extends the formula so the gain is all we can get
+	cell.potential = gain
+	cell.maxPotential = gain
+
+	if cell.potential-before > 0.00001 {
+		panic(fmt.Sprintf("Coverage can only decrease. Before %v, after: %v", before, cell.potential))
 	}
 
 	return cell.potential
@@ -2,25 +2,26 @@ package summarize
 
 import (
 	"container/heap"
+	"fmt"
 	"testing"
 
 	"golang.org/x/tools/container/intsets"
 )
 
-var y = Cover{true, 1}
-var n = Cover{false, 1}
+var y = Cover{1, 1}
+var n = Cover{0, 1}
 
 func TestHeap(t *testing.T) {
 	attr := Attribute{}
 
-	zero := Cell{nil, &attr, "zero", true}
-	one := Cell{nil, &attr, "one", true}
-	two := Cell{nil, &attr, "two", true}
-	three := Cell{nil, &attr, "three", true}
-	five := Cell{nil, &attr, "five", true}
+	zero := Cell{nil, nil, &attr, 0, true, false, nil, nil}
+	one := Cell{nil, nil, &attr, 1, true, false, nil, nil}
+	two := Cell{nil, nil, &attr, 2, true, false, nil, nil}
+	three := Cell{nil, nil, &attr, 3, true, false, nil, nil}
+	five := Cell{nil, nil, &attr, 5, true, false, nil, nil}
 
-	cells := CellHeap{&RankedCell{&zero, 0, -1, 0}, &RankedCell{&one, 1, -1, 1}, &RankedCell{&three, 3, -1, 2},
-		&RankedCell{&three, 3, -1, 3}, &RankedCell{&five, 5, -1, 4}, &RankedCell{&two, 2, -1, 5}}
+	cells := CellHeap{&RankedCell{&zero, 0, -1, 0, 0}, &RankedCell{&one, 1, -1, 1, 1}, &RankedCell{&three, 3, -1, 2, 2},
+		&RankedCell{&three, 3, -1, 3, 3}, &RankedCell{&five, 5, -1, 4, 4}, &RankedCell{&two, 2, -1, 5, 5}}
 
 	heap.Init(&cells)
 
@@ -56,10 +57,10 @@ func TestRecomputeCoverage(t *testing.T) {
 	cover[12] = &n
 	cover[17] = &y
 	cover[42] = &n
-	cell := Cell{cover, nil, "x", true}
-	rankedCell := RankedCell{&cell, 10, -1, 0}
+	cell := Cell{cover, nil, nil, 0, true, false, nil, nil}
+	rankedCell := RankedCell{&cell, 10, -1, 0, 0}
 
-	result := rankedCell.recomputeCoverage()
+	result := rankedCell.recomputeCoverage(0)
 
 	if result != 2 {
 		t.Error("Wrong cover")
@@ -77,8 +78,8 @@ func TestRecomputeCoverageFormula(t *testing.T) {
 	cover[42] = &n
 	cover[99] = &n
 	cover[123] = &n
-	cell := Cell{cover, nil, "x", true}
-	rankedCell := RankedCell{&cell, 10, -1, 0}
+	cell := Cell{cover, nil, nil, 0, true, false, nil, nil}
+	rankedCell := RankedCell{&cell, 10, -1, 0, 0}
 
 	covers := make(TupleCovers)
 	covers[17] = 2
@@ -86,7 +87,7 @@ func TestRecomputeCoverageFormula(t *testing.T) {
 	covers[123] = 3
 	covers[255] = 2
 	var set intsets.Sparse
-	formula := Formula{nil, set, covers, 5}
+	formula := Formula{nil, set, covers, 5, 0, nil, 0, 0}
 
 	formulaPotential := rankedCell.recomputeFormulaCoverage(&formula)
 
@@ -104,3 +105,62 @@ func TestRecomputeCoverageFormula(t *testing.T) {
 		t.Error("Wrong cover")
 	}
 }
+
+func popValues(cells CellHeap) []string {
+	heap.Init(&cells)
+	var values []string
+	for len(cells) > 0 {
+		values = append(values, heap.Pop(&cells).(*RankedCell).cell.value())
+	}
+	return values
+}
+
+func TestHierarchyTieBreak(t *testing.T) {
+	attr := Attribute{0, hierarchy, "h", newDictionary(), nil, nil, nil, TimeFormat{}, false, nil}
+
+	a := Cell{nil, nil, &attr, intern(&attr, "a"), true, false, nil, nil}
+	ab := Cell{nil, nil, &attr, intern(&attr, "a/b"), true, false, nil, nil}
+	abc := Cell{nil, nil, &attr, intern(&attr, "a/b/c"), true, false, nil, nil}
+	b := Cell{nil, nil, &attr, intern(&attr, "b"), true, false, nil, nil}
+
+	makeCells := func() CellHeap {
+		return CellHeap{&RankedCell{&abc, 2, 2, 0, 0}, &RankedCell{&ab, 2, 2, 1, 1}, &RankedCell{&b, 1, 1, 2, 2}, &RankedCell{&a, 2, 2, 3, 3}}
+	}
+
+	cells := makeCells()
+	cells.rank(TieBreak{})
+	if values := popValues(cells); fmt.Sprint(values) != "[a a/b a/b/c b]" {
+		t.Error("Should prefer general levels", values)
+	}
+
+	cells = makeCells()
+	cells.rank(TieBreak{Specific: true})
+	if values := popValues(cells); fmt.Sprint(values) != "[a/b/c a/b a b]" {
+		t.Error("Should prefer specific levels", values)
+	}
+}
+
+func TestWeightTieBreak(t *testing.T) {
+	attr0 := Attribute{0, single, "x", newDictionary(), nil, nil, nil, TimeFormat{}, false, nil}
+	attr1 := Attribute{1, hierarchy, "y", newDictionary(), nil, nil, nil, TimeFormat{}, false, nil}
+
+	x := Cell{nil, nil, &attr0, intern(&attr0, "x"), true, false, nil, nil}
+	y := Cell{nil, nil, &attr1, intern(&attr1, "y"), true, false, nil, nil}
+	yz := Cell{nil, nil, &attr1, intern(&attr1, "y/z"), true, false, nil, nil}
+
+	makeCells := func() CellHeap {
+		return CellHeap{&RankedCell{&x, 1, 1, 0, 0}, &RankedCell{&yz, 1, 1, 1, 1}, &RankedCell{&y, 1, 1, 2, 2}}
+	}
+
+	cells := makeCells()
+	cells.rank(TieBreak{})
+	if values := popValues(cells); fmt.Sprint(values) != "[x y y/z]" {
+		t.Error("Should prefer the first attribute", values)
+	}
+
+	cells = makeCells()
+	cells.rank(TieBreak{false, []float64{0.5, 1}})
+	if values := popValues(cells); fmt.Sprint(values) != "[y y/z x]" {
+		t.Error("Should prefer the attribute with higher weight", values)
+	}
+}
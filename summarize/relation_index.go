@@ -4,16 +4,22 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 )
 
 // Attribute is an attribute
 type Attribute struct {
-	index         int            // id for this attribute, used to see what attributes have been used in formula
-	attributeType Type           // attribute type
-	attributeName string         // attribute name
-	valueIndex    map[string]int // index for attribute values
-	cells         []Cell         // values and what tuples are covered
+	index         int         // id for this attribute, used to see what attributes have been used in formula
+	attributeType Type        // attribute type
+	attributeName string      // attribute name
+	values        *dictionary // interned attribute values
+	valueCells    []int32     // position of the positive cell by value id, -1 if there is none
+	negatedCells  []int32     // position of the negated cell by value id, -1 if there is none
+	cells         []Cell      // values and what tuples are covered
+	timeFormat    TimeFormat  // how values are parsed, only used for time attributes
+	bitmaps       bool        // whether cells store covers in bitmaps
+	weights       []float64   // cover weight of every tuple, only used by bitmap cells without equal weights
 }
 
 // RelationIndex is an inverted index
@@ -22,30 +28,193 @@ type RelationIndex struct {
 	numTuples int         // not really needed
 }
 
+// CoverRepresentation selects how cells store the tuples that they cover
+type CoverRepresentation int
+
+const (
+	// bitmaps for relations with at least bitmapThreshold tuples, maps otherwise
+	AutomaticCovers CoverRepresentation = iota
+	// a map from tuple to cover, fast for small relations
+	MapCovers
+	// compressed bitmaps and dense weights, much smaller for large relations
+	BitmapCovers
+)
+
+// relations with at least this many tuples use bitmaps if the representation is automatic
+const bitmapThreshold = 10000
+
+// setWeight sets the cover weight of a tuple
+func (attr *Attribute) setWeight(tuple int, weight float64) {
+	for len(attr.weights) <= tuple {
+		attr.weights = append(attr.weights, 0)
+	}
+	attr.weights[tuple] = weight
+}
+
+// SetCoverRepresentation changes how cells store their covers, existing cells are converted
+func (relation *RelationIndex) SetCoverRepresentation(representation CoverRepresentation) {
+	bitmaps := representation == BitmapCovers || (representation == AutomaticCovers && relation.numTuples >= bitmapThreshold)
+
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		if attr.bitmaps == bitmaps {
+			continue
+		}
+		attr.bitmaps = bitmaps
+
+		// bitmap cells read and write the weights of the attribute
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+			converted := makeCell(attr, cell.id, cell.equalWeights)
+			converted.negated = cell.negated
+			for _, tuple := range cell.coveredTuples() {
+				weight, count, _ := cell.lookup(tuple)
+				converted.add(tuple, weight)
+				for i := 0; i < count; i++ {
+					converted.setCovered(tuple, true)
+				}
+			}
+			*cell = converted
+		}
+
+		if !bitmaps {
+			attr.weights = nil
+		}
+	}
+}
+
 // Attrs returns the attributes
 func (relation RelationIndex) Attrs() *[]Attribute {
 	return &relation.attrs
 }
 
+// NumTuples returns the number of tuples
+func (relation *RelationIndex) NumTuples() int {
+	return relation.numTuples
+}
+
+// Name returns the name of the attribute
+func (attr *Attribute) Name() string {
+	return attr.attributeName
+}
+
+// Type returns the type of the attribute
+func (attr *Attribute) Type() Type {
+	return attr.attributeType
+}
+
 // AddCell adds a cell to an attribute
 func (attr *Attribute) AddCell(value string, tuple int, assessor Assessor) bool {
 	added := false
 
-	cover := Cover{false, assessor.Weight(attr, tuple)}
+	weight := assessor.Weight(attr, tuple)
 
-	idx, has := attr.valueIndex[value]
-	if !has {
+	idx := attr.find(value)
+	if idx < 0 {
 		c := MakeCell(attr, value, assessor.function == Equal)
-		c.covers[tuple] = &cover
-		attr.valueIndex[value] = len(attr.cells)
-		attr.cells = append(attr.cells, c)
+		c.add(tuple, weight)
+		attr.appendCell(c)
 		added = true
 	} else {
-		attr.cells[idx].covers[tuple] = &cover
+		attr.cells[idx].add(tuple, weight)
 	}
 	return added
 }
 
+// find returns the position of the positive cell for a value or -1 if there is none
+func (attr *Attribute) find(value string) int {
+	id, has := attr.values.lookup(value)
+	if !has || int(id) >= len(attr.valueCells) {
+		return -1
+	}
+	return int(attr.valueCells[id])
+}
+
+// findNegated returns the position of the negated cell for a value or -1 if there is none
+func (attr *Attribute) findNegated(value string) int {
+	id, has := attr.values.lookup(value)
+	if !has || int(id) >= len(attr.negatedCells) {
+		return -1
+	}
+	return int(attr.negatedCells[id])
+}
+
+// appendCell adds a cell, positive and negated cells can be found by their value
+func (attr *Attribute) appendCell(cell Cell) {
+	positions := &attr.valueCells
+	if cell.negated {
+		positions = &attr.negatedCells
+	}
+	for len(*positions) <= int(cell.id) {
+		*positions = append(*positions, -1)
+	}
+	(*positions)[cell.id] = int32(len(attr.cells))
+	attr.cells = append(attr.cells, cell)
+}
+
+// addPath adds a cell for every prefix of a path of hierarchy levels
+func (attr *Attribute) addPath(levels []string, tuple int, assessor Assessor) {
+	prefix := ""
+	for _, level := range levels {
+		p := ""
+		if len(prefix) > 0 {
+			p = "/"
+		}
+		prefix += p + level
+		attr.AddCell(prefix, tuple, assessor)
+	}
+}
+
+// AddNegations adds negated cells for single attribute values that cover at least minShare of the tuples that have a value
+// the negated cells cover the complement of the positive cell so this has to be called after all tuples were added
+func (relation *RelationIndex) AddNegations(minShare float64) {
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		if attr.attributeType != single {
+			continue
+		}
+
+		// the weight of every tuple that has a value for this attribute
+		weights := make(map[int]float64)
+		negatedValues := make(map[int32]bool)
+		for _, cell := range attr.cells {
+			if cell.negated {
+				negatedValues[cell.id] = true
+				continue
+			}
+			for _, tuple := range cell.coveredTuples() {
+				weights[tuple], _, _ = cell.lookup(tuple)
+			}
+		}
+
+		// add tuples in order, this is faster for bitmaps
+		tuples := make([]int, 0, len(weights))
+		for tuple := range weights {
+			tuples = append(tuples, tuple)
+		}
+		sort.Ints(tuples)
+
+		numCells := len(attr.cells)
+		for ic := 0; ic < numCells; ic++ {
+			positive := attr.cells[ic]
+			if positive.negated || negatedValues[positive.id] || float64(positive.size()) < minShare*float64(len(weights)) {
+				continue
+			}
+
+			negated := makeCell(attr, positive.id, positive.equalWeights)
+			negated.negated = true
+			for _, tuple := range tuples {
+				if _, _, has := positive.lookup(tuple); !has {
+					negated.add(tuple, weights[tuple])
+				}
+			}
+			if negated.size() > 0 {
+				attr.appendCell(negated)
+			}
+		}
+	}
+}
+
 // NewIndex creates a new index
 func NewIndex(typeNames []string, names []string, numTuples int) (*RelationIndex, error) {
 	if len(names) != len(typeNames) {
@@ -58,6 +227,18 @@ func NewIndex(typeNames []string, names []string, numTuples int) (*RelationIndex
 	for i, attributeType := range typeNames {
 		attr := &index[i]
 
+		// time attributes may add an hour level and specify a layout, e.g. "time:2006-01-02", "time:hours" or "time:hours:2006-01-02 15:04"
+		layout := ""
+		hours := false
+		if strings.HasPrefix(attributeType, timestamp.String()+":") {
+			layout = attributeType[len(timestamp.String())+1:]
+			attributeType = timestamp.String()
+			if layout == "hours" || strings.HasPrefix(layout, "hours:") {
+				hours = true
+				layout = strings.TrimPrefix(strings.TrimPrefix(layout, "hours"), ":")
+			}
+		}
+
 		switch attributeType {
 		case single.String():
 			attr.attributeType = single
@@ -65,11 +246,18 @@ func NewIndex(typeNames []string, names []string, numTuples int) (*RelationIndex
 			attr.attributeType = set
 		case hierarchy.String():
 			attr.attributeType = hierarchy
+		case timestamp.String():
+			attr.attributeType = timestamp
+			attr.timeFormat = TimeFormat{DefaultTimeFormat.Layouts, hours}
+			if len(layout) > 0 {
+				attr.timeFormat = TimeFormat{[]string{layout}, hours}
+			}
 		}
 
 		attr.attributeName = names[i]
+		attr.bitmaps = numTuples >= bitmapThreshold
 		attr.index = i
-		attr.valueIndex = make(map[string]int)
+		attr.values = newDictionary()
 	}
 
 	return &RelationIndex{index, numTuples}, nil
@@ -89,48 +277,59 @@ func NewIndexFromString(description string, assessor Assessor) (*RelationIndex,
 
 	assessor.NumTuples = relation.numTuples
 
+	for tuple, line := range lines[2:] {
+		if err := relation.addRow(strings.Split(line, ","), tuple, assessor); err != nil {
+			return nil, err
+		}
+	}
+
+	return relation, nil
+}
+
+// addRow adds the raw values of a tuple, empty values are null
+func (relation *RelationIndex) addRow(values []string, tuple int, assessor Assessor) error {
 	index := relation.attrs
 	numAttr := len(index)
 
-	for tuple, line := range lines[2:] {
-		values := strings.Split(line, ",")
-		if len(values) != numAttr {
-			err := fmt.Sprintf("Wrong number of attributes. Expected %d but got %d.", numAttr, len(values))
-			return nil, errors.New(err)
-		}
+	if len(values) != numAttr {
+		err := fmt.Sprintf("Wrong number of attributes. Expected %d but got %d.", numAttr, len(values))
+		return errors.New(err)
+	}
 
-		for i, value := range values {
-			value = strings.TrimSpace(value)
+	for i, value := range values {
+		value = strings.TrimSpace(value)
 
-			if len(value) == 0 {
-				// null
-				continue
-			}
+		if len(value) == 0 {
+			// null
+			continue
+		}
 
-			switch index[i].attributeType {
-			case single:
-				index[i].AddCell(value, tuple, assessor)
-			case set:
-				setValues := strings.Split(value, " ")
-				for _, setValue := range setValues {
-					index[i].AddCell(setValue, tuple, assessor)
-				}
-			case hierarchy:
-				prefix := ""
-				hValues := strings.Split(value, " ")
-				for _, hValue := range hValues {
-					p := ""
-					if len(prefix) > 0 {
-						p = "/"
-					}
-					prefix += p + hValue
-					index[i].AddCell(prefix, tuple, assessor)
-				}
+		switch index[i].attributeType {
+		case single:
+			index[i].AddCell(value, tuple, assessor)
+		case set:
+			setValues := strings.Split(value, " ")
+			for _, setValue := range setValues {
+				index[i].AddCell(setValue, tuple, assessor)
+			}
+		case hierarchy:
+			index[i].addPath(strings.Split(value, " "), tuple, assessor)
+		case timestamp:
+			if err := index[i].AddTime(value, tuple, assessor); err != nil {
+				return err
 			}
 		}
 	}
 
-	return relation, nil
+	return nil
+}
+
+// Finalize drops the indexes from values to cells, they are rebuilt if values are added again
+// call this after all tuples were added to save memory, values are then found by binary search in their ids sorted by value
+func (relation *RelationIndex) Finalize() {
+	for ia := range relation.attrs {
+		relation.attrs[ia].values.finalize()
+	}
 }
 
 // Reset resets coverage
@@ -138,10 +337,7 @@ func (relation *RelationIndex) Reset() {
 	for ia := range relation.attrs {
 		attr := &relation.attrs[ia]
 		for ic := range attr.cells {
-			cell := &attr.cells[ic]
-			for tc := range cell.covers {
-				cell.covers[tc].covered = false
-			}
+			attr.cells[ic].resetCovered()
 		}
 	}
 }
@@ -152,10 +348,15 @@ func (relation RelationIndex) String() string {
 	for _, attribute := range relation.attrs {
 		fmt.Fprintf(&buffer, "Attribute %s (%s) of length %d:\n", attribute.attributeName, attribute.attributeType, len(attribute.cells))
 		for _, cell := range attribute.cells {
-			fmt.Fprintf(&buffer, " Value '%s' covers: [", cell.value)
+			if cell.negated {
+				fmt.Fprintf(&buffer, " Value != '%s' covers: [", cell.value())
+			} else {
+				fmt.Fprintf(&buffer, " Value '%s' covers: [", cell.value())
+			}
 			var tuples []string
-			for tuple, covered := range cell.covers {
-				tuples = append(tuples, fmt.Sprintf("%d:(%s %.3g)", tuple, bString(covered.covered), covered.weight))
+			for _, tuple := range cell.coveredTuples() {
+				weight, count, _ := cell.lookup(tuple)
+				tuples = append(tuples, fmt.Sprintf("%d:(%s %.3g)", tuple, bString(count > 0), weight))
 			}
 
 			buffer.WriteString(strings.Join(tuples, " "))
@@ -0,0 +1,62 @@
+package summarize
+
+import "context"
+
+// relative difference of covers that is attributed to rounding when formulas are re-scored
+const coverTolerance = 1e-9
+
+// Resummarize repairs a summary after tuples were added or removed
+// the previous formulas are re-scored in order and kept if they still cover at least 1 - stability of what they covered before,
+// the other formulas are replaced by new formulas that are appended after the kept ones, the replaced formulas do not come back
+// stability 0 only keeps formulas that did not lose cover, stability 1 keeps every formula that still covers something
+// like Summarize, the tuples that the formulas cover are covered afterwards, the summary is empty if Check rejects the options
+func (relation *RelationIndex) Resummarize(previous SummaryResult, size int, options Options, stability float64) SummaryResult {
+	if options.Check() != nil {
+		return SummaryResult{}
+	}
+
+	var summary Summary
+	var formulaCover []float64
+	summaryCover := 0.0
+	var dropped Summary
+
+	for i, values := range previous.Summary {
+		if len(summary) >= size {
+			break
+		}
+
+		formula, has := relation.formula(values, options.Overlap)
+		if !has || formula.cover <= 0 {
+			continue
+		}
+		if i < len(previous.FormulaCover) && formula.cover < (1-stability)*previous.FormulaCover[i]*(1-coverTolerance) {
+			dropped = append(dropped, values)
+			continue
+		}
+
+		formula.CoverIndex(relation)
+		summary = append(summary, values)
+		formulaCover = append(formulaCover, formula.cover)
+		summaryCover += formula.cover
+	}
+
+	// the kept formulas were not searched again so they have no alternatives
+	var alternatives [][]Alternative
+	if len(summary) < size {
+		fresh, _ := relation.summarize(context.Background(), size-len(summary), options, true, dropped)
+		if options.Alternatives > 0 {
+			alternatives = make([][]Alternative, len(summary))
+			alternatives = append(alternatives, fresh.Alternatives...)
+		}
+		summary = append(summary, fresh.Summary...)
+		formulaCover = append(formulaCover, fresh.FormulaCover...)
+		summaryCover += fresh.SummaryCover
+	}
+
+	return SummaryResult{
+		summary,
+		formulaCover,
+		summaryCover,
+		alternatives,
+	}
+}
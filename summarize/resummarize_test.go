@@ -0,0 +1,115 @@
+package summarize
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResummarize(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single\nvenue,year\nSIGMOD,2015\nSIGMOD,2014\nSIGMOD,2013\nSIGMOD,2012\nVLDB,2015\nVLDB,2014\nVLDB,2013\nICDE,2011", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Deterministic: true}
+
+	previous := relation.SummarizeWithOptions(2, options)
+	relation.Reset()
+
+	// nothing changed so the summary stays the same
+	result := relation.Resummarize(previous, 2, options, 0)
+	relation.Reset()
+	if fmt.Sprintf("%v", result) != fmt.Sprintf("%v", previous) {
+		t.Error("Unchanged index should keep the summary", result, previous)
+	}
+
+	// SIGMOD loses most of its tuples
+	for i := 0; i < 3; i++ {
+		if err := relation.RemoveTuple(0, assessor); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result = relation.Resummarize(previous, 2, options, 1)
+	relation.Reset()
+	if fmt.Sprintf("%v", result.Summary) != fmt.Sprintf("%v", previous.Summary) {
+		t.Error("Stability 1 should keep formulas that still cover something", result.Summary)
+	}
+	if result.FormulaCover[0] != 1 || result.FormulaCover[1] != 3 {
+		t.Error("Formulas should be re-scored", result.FormulaCover)
+	}
+
+	result = relation.Resummarize(previous, 2, options, 0.5)
+	relation.Reset()
+	if len(result.Summary) != 2 || result.Summary[0][0].value != "VLDB" || result.FormulaCover[0] != 3 {
+		t.Error("SIGMOD should be replaced and VLDB kept", result)
+	}
+	if result.Summary[1][0].value == "SIGMOD" {
+		t.Error("Replaced formula should not come back", result)
+	}
+	if result.SummaryCover != result.FormulaCover[0]+result.FormulaCover[1] {
+		t.Error("Wrong summary cover", result)
+	}
+
+	// more formulas than before
+	result = relation.Resummarize(previous, 3, options, 1)
+	if len(result.Summary) != 3 {
+		t.Error("Missing formulas should be added", result)
+	}
+}
+
+func TestResummarizeDropped(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	rows := "single\nvenue"
+	for i := 0; i < 10; i++ {
+		rows += "\nSIGMOD"
+	}
+	rows += "\nVLDB\nVLDB\nVLDB"
+	relation, err := NewIndexFromString(rows, assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Deterministic: true}
+
+	previous := relation.SummarizeWithOptions(1, options)
+	relation.Reset()
+	if fmt.Sprint(previous.Summary) != "[[{0 venue SIGMOD false []}]]" {
+		t.Fatal("Wrong summary", previous)
+	}
+
+	// SIGMOD loses half of its tuples but still covers the most
+	for i := 0; i < 5; i++ {
+		if err := relation.RemoveTuple(0, assessor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result := relation.Resummarize(previous, 1, options, 0.4)
+	if fmt.Sprint(result.Summary) != "[[{0 venue VLDB false []}]]" || result.SummaryCover != 3 {
+		t.Error("Replaced formula should not come back", result)
+	}
+}
+
+func TestResummarizeDroppedOrder(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single,single\na,b,c\nx,p,u\nx,p,u\nx,p,u\nx,p,v\nx,q,v\ny,q,w", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{Deterministic: true}
+
+	// the search adds a = x first, the replaced formula has its cells in another order
+	dropped := []Value{MakeValue("b", "p", false), MakeValue("a", "x", false), MakeValue("c", "u", false)}
+	previous := SummaryResult{Summary{dropped}, []float64{100}, 100, nil}
+	result := relation.Resummarize(previous, 2, options, 0)
+	relation.Reset()
+	for _, values := range result.Summary {
+		if formulaKey(values) == formulaKey(dropped) {
+			t.Error("Replaced formula should not come back in another order", result.Summary)
+		}
+	}
+
+	// the first cell of the replaced formula can still start formulas
+	if len(result.Summary) != 2 || fmt.Sprint(result.Summary[0][0]) != "{0 a x false []}" {
+		t.Error("Formulas should start with the first cell of the replaced formula", result.Summary)
+	}
+}
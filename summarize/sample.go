@@ -0,0 +1,402 @@
+package summarize
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Sampling configures approximate summaries that are computed from a random sample of the tuples
+type Sampling struct {
+	Size       int     // number of tuples that are drawn for each of the two samples
+	Weighted   bool    // draw tuples with replacement and with a probability proportional to their weight, uniformly without replacement otherwise
+	Seed       int64   // seed for drawing the sample
+	Confidence float64 // confidence level of the intervals
+	Exact      bool    // re-score the formulas on the full index, which takes time linear in the tuples that they cover
+}
+
+// DefaultSampling draws ten thousand tuples uniformly and reports 95% confidence intervals without re-scoring the formulas
+var DefaultSampling = Sampling{
+	10000,
+	false,
+	1,
+	0.95,
+	false,
+}
+
+// Interval is an estimate with a confidence interval
+type Interval struct {
+	Estimate float64 // the estimate
+	Low      float64 // lower bound of the confidence interval
+	High     float64 // upper bound of the confidence interval
+}
+
+// ApproximateResult is a summary of a sample, the covers are re-scored exactly on the full index if the sampling is exact
+type ApproximateResult struct {
+	SummaryResult              // the summary and the exact covers of its formulas, or their estimates if the sampling is not exact
+	FormulaEstimate []Interval // cover of every formula as estimated from the sample
+	SummaryEstimate Interval   // cover of the summary as estimated from the sample
+	SampleSize      int        // number of tuples that the covers were estimated on
+}
+
+// Sample is an index of two independent random samples of the tuples of a relation
+// summaries are chosen on one sample and their covers are estimated on the other, so the estimates are not biased towards the chosen formulas
+// the weights are scaled so that the cover in a sample estimates the cover in the relation
+// it can be summarized repeatedly, the coverage of the relation at the time of sampling is ignored
+type Sample struct {
+	relation   *RelationIndex // the full index
+	selection  *RelationIndex // the sample that summaries are chosen on, tuple i is the i-th draw
+	estimation *RelationIndex // the sample that covers are estimated on
+	fraction   float64        // share of the tuples that were drawn without replacement, 0 for draws with replacement
+	confidence float64        // confidence level of the intervals
+	exact      bool           // whether the formulas are re-scored on the full index
+}
+
+// Sample draws random samples of the tuples
+// drawing weighted samples makes a pass over all covers, uniform samples only look at the drawn tuples of every cell
+func (relation *RelationIndex) Sample(sampling Sampling) *Sample {
+	random := rand.New(rand.NewSource(sampling.Seed))
+
+	var weights []float64
+	if sampling.Weighted {
+		weights = relation.tupleWeights()
+	}
+	selection, fraction := relation.draw(random, sampling.Size, weights)
+	estimation, _ := relation.draw(random, sampling.Size, weights)
+
+	confidence := sampling.Confidence
+	if confidence <= 0 || confidence >= 1 {
+		confidence = DefaultSampling.Confidence
+	}
+
+	return &Sample{relation, selection, estimation, fraction, confidence, sampling.Exact}
+}
+
+// draw builds an index of a random sample of the tuples and returns it with the share of the tuples that were drawn
+// tuples are drawn with probabilities proportional to their weights if there are weights, uniformly without replacement otherwise
+func (relation *RelationIndex) draw(random *rand.Rand, size int, weights []float64) (*RelationIndex, float64) {
+	// the drawn tuples in ascending order and how much the weight of each draw is scaled
+	var tuples []int
+	var factors []float64
+	fraction := 0.0
+
+	if weights != nil {
+		cumulative := make([]float64, len(weights))
+		total := 0.0
+		for tuple, weight := range weights {
+			total += weight
+			cumulative[tuple] = total
+		}
+		if total > 0 {
+			for i := 0; i < size; i++ {
+				r := random.Float64() * total
+				tuples = append(tuples, sort.Search(len(cumulative), func(t int) bool { return cumulative[t] > r }))
+			}
+		}
+		sort.Ints(tuples)
+		for _, tuple := range tuples {
+			// Hansen-Hurwitz estimator, the draw stands for 1 / (draws * probability) tuples
+			factors = append(factors, total/(float64(len(tuples))*weights[tuple]))
+		}
+	} else {
+		tuples = drawUniform(random, relation.numTuples, size)
+		if len(tuples) > 0 {
+			fraction = float64(len(tuples)) / float64(relation.numTuples)
+		}
+		for range tuples {
+			factors = append(factors, 1/fraction)
+		}
+	}
+
+	return relation.subset(tuples, factors, nil), fraction
+}
+
+// subset builds an index of some tuples in ascending order, tuple i of the index is tuples[i]
+// the weight of tuple i is scaled by factors[i] if there are factors, cells of the subset that keep rejects are left out if keep is not nil
+func (relation *RelationIndex) subset(tuples []int, factors []float64, keep func(cell *Cell) bool) *RelationIndex {
+	typeNames := make([]string, len(relation.attrs))
+	names := make([]string, len(relation.attrs))
+	for ia, attr := range relation.attrs {
+		typeNames[ia] = attr.attributeType.String()
+		names[ia] = attr.attributeName
+	}
+	sub, _ := NewIndex(typeNames, names, len(tuples))
+
+	draws := makeDraws(tuples)
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		subAttr := &sub.attrs[ia]
+		subAttr.timeFormat = attr.timeFormat
+
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+
+			var subCell *Cell
+			draws.covered(cell, func(draw int) {
+				if subCell == nil {
+					c := MakeCell(subAttr, cell.value(), false)
+					c.negated = cell.negated
+					subCell = &c
+				}
+				weight, _, _ := cell.lookup(tuples[draw])
+				if factors != nil {
+					weight *= factors[draw]
+				}
+				subCell.add(draw, weight)
+			})
+			if subCell != nil && (keep == nil || keep(subCell)) {
+				subAttr.appendCell(*subCell)
+			}
+		}
+	}
+
+	return sub
+}
+
+// Sample draws random samples of the tuples
+func (index *MappedIndex) Sample(sampling Sampling) *Sample {
+	return index.run().Sample(sampling)
+}
+
+// SummarizeApproximately summarizes random samples of the tuples
+func (relation *RelationIndex) SummarizeApproximately(size int, options Options, sampling Sampling) ApproximateResult {
+	return relation.Sample(sampling).Summarize(size, options)
+}
+
+// Summarize summarizes the sample and re-scores the formulas on the full index if the sampling is exact
+// the full index is not covered afterwards so that a sample can be summarized repeatedly
+func (sample *Sample) Summarize(size int, options Options) ApproximateResult {
+	sample.selection.Reset()
+	summary := sample.selection.SummarizeWithOptions(size, options).Summary
+	sample.selection.Reset()
+
+	// every draw estimates the cover as the number of draws times what it contributes
+	draws := float64(sample.estimation.numTuples)
+	sums := make([]float64, len(summary))
+	squares := make([]float64, len(summary))
+	totals := make([]float64, sample.estimation.numTuples)
+	// the formulas are scored the way they were chosen
+	sample.estimation.scoreSummary(summary, options.Overlap, func(formula int, tuple int, cover float64) {
+		sums[formula] += draws * cover
+		squares[formula] += draws * cover * draws * cover
+		totals[tuple] += draws * cover
+	})
+	sample.estimation.Reset()
+
+	z := math.Sqrt2 * math.Erfinv(sample.confidence)
+
+	estimates := make([]Interval, len(summary))
+	for i := range summary {
+		estimates[i] = sample.interval(sums[i], squares[i], z)
+	}
+	sum, square := 0.0, 0.0
+	for _, total := range totals {
+		sum += total
+		square += total * total
+	}
+
+	formulaCover := make([]float64, len(summary))
+	for i, estimate := range estimates {
+		formulaCover[i] = estimate.Estimate
+	}
+	if sample.exact {
+		sample.relation.Reset()
+		formulaCover = sample.relation.scoreSummary(summary, options.Overlap, nil)
+		sample.relation.Reset()
+	}
+	summaryCover := 0.0
+	for _, cover := range formulaCover {
+		summaryCover += cover
+	}
+
+	return ApproximateResult{
+		SummaryResult{summary, formulaCover, summaryCover, nil},
+		estimates,
+		sample.interval(sum, square, z),
+		sample.estimation.numTuples,
+	}
+}
+
+// interval estimates the mean of what the draws estimate from the sum and the sum of squares
+// the normal approximation is used with the quantile z of the confidence level
+func (sample *Sample) interval(sum float64, squares float64, z float64) Interval {
+	n := float64(sample.estimation.numTuples)
+	if n == 0 {
+		return Interval{0, 0, 0}
+	}
+	mean := sum / n
+
+	variance := 0.0
+	if n > 1 {
+		variance = math.Max(0, (squares-n*mean*mean)/(n-1)) * (1 - sample.fraction) / n
+	}
+	width := z * math.Sqrt(variance)
+
+	return Interval{mean, math.Max(0, mean-width), mean + width}
+}
+
+// drawUniform draws k distinct tuples out of n uniformly and returns them in ascending order
+func drawUniform(random *rand.Rand, n int, k int) []int {
+	if k > n {
+		k = n
+	}
+
+	// Floyd's algorithm
+	chosen := make(map[int]bool, k)
+	for j := n - k; j < n; j++ {
+		tuple := random.Intn(j + 1)
+		if chosen[tuple] {
+			tuple = j
+		}
+		chosen[tuple] = true
+	}
+
+	tuples := make([]int, 0, k)
+	for tuple := range chosen {
+		tuples = append(tuples, tuple)
+	}
+	sort.Ints(tuples)
+	return tuples
+}
+
+// tupleWeights returns the sum of the weights of the cells that cover every tuple
+func (relation *RelationIndex) tupleWeights() []float64 {
+	weights := make([]float64, relation.numTuples)
+	for _, attr := range relation.attrs {
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+			if cell.negated {
+				continue
+			}
+			for _, tuple := range cell.coveredTuples() {
+				weight, _, _ := cell.lookup(tuple)
+				for len(weights) <= tuple {
+					weights = append(weights, 0)
+				}
+				weights[tuple] += weight
+			}
+		}
+	}
+	return weights
+}
+
+// draws finds the draws of a sample in the covers of cells
+type draws struct {
+	tuples []int    // drawn tuples in ascending order
+	keys   []uint16 // high bits of the drawn tuples, as in bitmaps
+	starts []int    // the tuples with keys[i] are tuples[starts[i]:starts[i+1]]
+}
+
+func makeDraws(tuples []int) draws {
+	d := draws{tuples, nil, nil}
+	for i, tuple := range tuples {
+		key := uint16(tuple >> 16)
+		if len(d.keys) == 0 || d.keys[len(d.keys)-1] != key {
+			d.keys = append(d.keys, key)
+			d.starts = append(d.starts, i)
+		}
+	}
+	d.starts = append(d.starts, len(tuples))
+	return d
+}
+
+// covered calls f with every draw of a tuple that a cell covers
+func (d draws) covered(cell *Cell, f func(draw int)) {
+	if len(d.tuples) == 0 {
+		return
+	}
+
+	if cell.bitmap != nil {
+		// cells whose tuples all come after the last draw have none of them
+		b := &cell.bitmap.tuples
+		it := b.Iterator()
+		if first, ok := it.Next(); !ok || first > d.tuples[len(d.tuples)-1] {
+			return
+		}
+
+		// only look at the chunks that have draws
+		i, j := 0, 0
+		for i < len(b.keys) && j < len(d.keys) {
+			switch {
+			case b.keys[i] < d.keys[j]:
+				i++
+			case b.keys[i] > d.keys[j]:
+				j++
+			default:
+				chunk := &b.chunks[i]
+				start, end := d.starts[j], d.starts[j+1]
+				if chunk.n < end-start {
+					// the chunk has fewer tuples than there are draws in it, so its tuples are looked up in the draws
+					high := int(b.keys[i]) << 16
+					chunk.each(func(x uint16) {
+						tuple := high | int(x)
+						for draw := start + sort.SearchInts(d.tuples[start:end], tuple); draw < end && d.tuples[draw] == tuple; draw++ {
+							f(draw)
+						}
+					})
+				} else {
+					for draw := start; draw < end; draw++ {
+						if chunk.contains(uint16(d.tuples[draw])) {
+							f(draw)
+						}
+					}
+				}
+				i++
+				j++
+			}
+		}
+		return
+	}
+
+	if len(cell.covers) < len(d.tuples) {
+		for tuple := range cell.covers {
+			for draw := sort.SearchInts(d.tuples, tuple); draw < len(d.tuples) && d.tuples[draw] == tuple; draw++ {
+				f(draw)
+			}
+		}
+		return
+	}
+	for draw, tuple := range d.tuples {
+		if _, has := cell.covers[tuple]; has {
+			f(draw)
+		}
+	}
+}
+
+// scoreSummary computes what the formulas of a summary cover in this index and covers the tuples
+// f is called with what a formula covers of every tuple if it is not nil, tuples that were covered before count with the given overlap
+func (relation *RelationIndex) scoreSummary(summary Summary, overlap float64, f func(formula int, tuple int, cover float64)) []float64 {
+	formulaCover := make([]float64, len(summary))
+
+	for i, values := range summary {
+		formula, has := relation.formula(values, overlap)
+		if !has {
+			continue
+		}
+
+		formulaCover[i] = formula.cover
+		if f != nil {
+			for tuple, cover := range formula.tupleCover {
+				f(i, tuple, cover)
+			}
+		}
+		formula.CoverIndex(relation)
+	}
+
+	return formulaCover
+}
+
+// DebugPrint prints a summary with the estimated covers
+func (result ApproximateResult) DebugPrint() {
+	result.SummaryResult.DebugPrint()
+	fmt.Printf("Estimated from %d sampled tuples:\n", result.SampleSize)
+	for i, estimate := range result.FormulaEstimate {
+		fmt.Printf(" formula %d: %s (exact: %g)\n", i+1, estimate, result.FormulaCover[i])
+	}
+	fmt.Printf(" summary: %s (exact: %g)\n", result.SummaryEstimate, result.SummaryCover)
+}
+
+func (interval Interval) String() string {
+	return fmt.Sprintf("%.4g [%.4g, %.4g]", interval.Estimate, interval.Low, interval.High)
+}
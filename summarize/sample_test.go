@@ -0,0 +1,175 @@
+package summarize
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSampleAllTuples(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single\nvenue,year\nSIGMOD,2015\nSIGMOD,2014\nSIGMOD,2013\nSIGMOD,2012\nVLDB,2015\nVLDB,2014\nVLDB,2013\nICDE,2015", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relation.AddNegations(0.3)
+	options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+
+	expected := relation.SummarizeWithOptions(3, options)
+	relation.Reset()
+
+	// a uniform sample of all tuples is the relation itself
+	result := relation.SummarizeApproximately(3, options, Sampling{100, false, 1, 0.95, true})
+	if result.SampleSize != 8 {
+		t.Error("Wrong sample size", result.SampleSize)
+	}
+	if fmt.Sprintf("%v", result.SummaryResult) != fmt.Sprintf("%v", expected) {
+		t.Error("Sample of all tuples should give the exact summary", result.SummaryResult, expected)
+	}
+	for i, estimate := range result.FormulaEstimate {
+		if estimate.Low != estimate.High || math.Abs(estimate.Estimate-expected.FormulaCover[i]) > 1e-9 {
+			t.Error("Estimate should be exact", estimate, expected.FormulaCover[i])
+		}
+	}
+	if math.Abs(result.SummaryEstimate.Estimate-expected.SummaryCover) > 1e-9 {
+		t.Error("Wrong summary estimate", result.SummaryEstimate, expected.SummaryCover)
+	}
+}
+
+func TestSampleEstimates(t *testing.T) {
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		relation := makeRandomRelation(20000, representation)
+
+		for _, weighted := range []bool{false, true} {
+			relation.Reset()
+			result := relation.SummarizeApproximately(5, DefaultOptions, Sampling{2000, weighted, 7, 0.99, true})
+			if len(result.Summary) != 5 || result.SampleSize != 2000 {
+				t.Fatal("Wrong summary", len(result.Summary), result.SampleSize)
+			}
+
+			total := 0.0
+			for i, cover := range result.FormulaCover {
+				estimate := result.FormulaEstimate[i]
+				if cover <= 0 || estimate.Low > estimate.Estimate || estimate.High < estimate.Estimate {
+					t.Error("Wrong estimate", cover, estimate)
+				}
+				if math.Abs(estimate.Estimate-cover) > 0.2*cover {
+					t.Error("Estimate is far from the exact cover", weighted, estimate, cover)
+				}
+				total += cover
+			}
+			if math.Abs(total-result.SummaryCover) > 1e-6 {
+				t.Error("Wrong summary cover", total, result.SummaryCover)
+			}
+			estimate := result.SummaryEstimate
+			if estimate.Low > result.SummaryCover || estimate.High < result.SummaryCover {
+				t.Error("Summary cover should be in the confidence interval", weighted, estimate, result.SummaryCover)
+			}
+
+			// the full index is not covered, so the formulas cover the same again
+			again := relation.scoreSummary(result.Summary, 0, nil)
+			for i, cover := range again {
+				if math.Abs(cover-result.FormulaCover[i]) > 1e-6 {
+					t.Error("Formulas should not be covered in the full index", again, result.FormulaCover)
+				}
+			}
+			relation.Reset()
+		}
+	}
+}
+
+func TestSampleEstimatesOnly(t *testing.T) {
+	relation := makeRandomRelation(5000, BitmapCovers)
+	sampling := Sampling{500, false, 3, 0.95, false}
+	result := relation.SummarizeApproximately(5, DefaultOptions, sampling)
+
+	total := 0.0
+	for i, cover := range result.FormulaCover {
+		if cover != result.FormulaEstimate[i].Estimate {
+			t.Error("Covers should be the estimates", cover, result.FormulaEstimate[i])
+		}
+		total += cover
+	}
+	if math.Abs(total-result.SummaryCover) > 1e-6 || math.Abs(total-result.SummaryEstimate.Estimate) > 1e-6 {
+		t.Error("Wrong summary cover", total, result.SummaryCover, result.SummaryEstimate)
+	}
+
+	sampling.Exact = true
+	exact := relation.SummarizeApproximately(5, DefaultOptions, sampling)
+	if fmt.Sprint(exact.FormulaEstimate) != fmt.Sprint(result.FormulaEstimate) || fmt.Sprint(exact.Summary) != fmt.Sprint(result.Summary) {
+		t.Error("Re-scoring should not change the summary or the estimates", exact, result)
+	}
+}
+
+func TestSampleRepeatedly(t *testing.T) {
+	relation := makeRandomRelation(5000, BitmapCovers)
+	sample := relation.Sample(Sampling{500, true, 3, 0.95, true})
+	options := Options{Deterministic: true}
+
+	first := sample.Summarize(5, options)
+	second := sample.Summarize(5, options)
+	if first.SummaryCover <= 0 {
+		t.Fatal("Wrong summary cover", first.SummaryCover)
+	}
+	if fmt.Sprint(second.SummaryResult) != fmt.Sprint(first.SummaryResult) {
+		t.Error("Summarizing a sample again should give the same summary", second.SummaryResult, first.SummaryResult)
+	}
+}
+
+func BenchmarkSample(b *testing.B) {
+	relation := makeRandomRelation(100000, BitmapCovers)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		relation.Sample(DefaultSampling)
+	}
+}
+
+func benchmarkSummarizeSample(b *testing.B, exact bool) {
+	relation := makeRandomRelation(100000, BitmapCovers)
+	sampling := DefaultSampling
+	sampling.Exact = exact
+	sample := relation.Sample(sampling)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sample.Summarize(50, DefaultOptions)
+	}
+}
+
+func BenchmarkSummarizeSample(b *testing.B) {
+	benchmarkSummarizeSample(b, false)
+}
+
+func BenchmarkSummarizeSampleExact(b *testing.B) {
+	benchmarkSummarizeSample(b, true)
+}
+
+func TestDraws(t *testing.T) {
+	maps := makeRandomRelation(70000, MapCovers)
+	bitmaps := makeRandomRelation(70000, BitmapCovers)
+	random := rand.New(rand.NewSource(3))
+
+	// few draws are looked up in the cells, many draws with repeated tuples look up the tuples of sparse cells
+	for _, size := range []int{10, 20000} {
+		var tuples []int
+		for i := 0; i < size; i++ {
+			tuples = append(tuples, random.Intn(65000)+2000)
+		}
+		sort.Ints(tuples)
+		d := makeDraws(tuples)
+
+		for ia := range maps.attrs {
+			for ic := range maps.attrs[ia].cells {
+				var expected, got []int
+				d.covered(&maps.attrs[ia].cells[ic], func(draw int) { expected = append(expected, draw) })
+				d.covered(&bitmaps.attrs[ia].cells[ic], func(draw int) { got = append(got, draw) })
+				// maps are not ordered
+				sort.Ints(expected)
+				if fmt.Sprint(got) != fmt.Sprint(expected) {
+					t.Fatal("Bitmap cells should have the same draws", maps.attrs[ia].cells[ic].value(), got, expected)
+				}
+			}
+		}
+	}
+}
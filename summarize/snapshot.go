@@ -0,0 +1,298 @@
+package summarize
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// snapshots start with the magic bytes and the version of the format
+const snapshotMagic = "SUMIDX"
+
+// version of the snapshot format, has to change whenever the layout changes
+const snapshotVersion = 1
+
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorruptSnapshot = errors.New("Corrupt index snapshot.")
+
+// A snapshot is the magic bytes followed by varint encoded fields and a CRC-32C checksum of everything before it.
+//
+//	version
+//	number of tuples, number of attributes
+//	for every attribute: type and name
+//	for every attribute:
+//	  time layouts and whether times have hours
+//	  whether cells use bitmaps and the weights of the attribute
+//	  cells, for every cell: value, equal weights, negated, tuples as deltas, weights if the cell stores them
+//
+// Strings and lists are prefixed by their length, weights are little endian float64.
+// Which tuples are covered is not part of a snapshot.
+
+// WriteTo writes a binary snapshot of the index that ReadIndex can load
+func (relation *RelationIndex) WriteTo(w io.Writer) (int64, error) {
+	sw := snapshotWriter{bufio.NewWriter(w), crc32.New(snapshotTable), 0, nil, nil}
+
+	sw.write([]byte(snapshotMagic))
+	sw.uvarint(snapshotVersion)
+	sw.uvarint(uint64(relation.numTuples))
+	sw.uvarint(uint64(len(relation.attrs)))
+	for _, attr := range relation.attrs {
+		sw.string(attr.attributeType.String())
+		sw.string(attr.attributeName)
+	}
+
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+
+		sw.uvarint(uint64(len(attr.timeFormat.Layouts)))
+		for _, layout := range attr.timeFormat.Layouts {
+			sw.string(layout)
+		}
+		sw.bool(attr.timeFormat.Hours)
+
+		sw.bool(attr.bitmaps)
+		sw.uvarint(uint64(len(attr.weights)))
+		for _, weight := range attr.weights {
+			sw.float(weight)
+		}
+
+		sw.uvarint(uint64(len(attr.cells)))
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+			sw.string(cell.value())
+			sw.bool(cell.equalWeights)
+			sw.bool(cell.negated)
+
+			tuples := cell.sortedTuples()
+			sw.uvarint(uint64(len(tuples)))
+			previous := 0
+			for _, tuple := range tuples {
+				sw.uvarint(uint64(tuple - previous))
+				previous = tuple
+			}
+			if cell.bitmap == nil && !cell.equalWeights {
+				for _, tuple := range tuples {
+					sw.float(cell.covers[tuple].weight)
+				}
+			}
+		}
+	}
+
+	// the checksum is not part of what it checks
+	var checksum [4]byte
+	binary.LittleEndian.PutUint32(checksum[:], sw.crc.Sum32())
+	sw.crc = nil
+	sw.write(checksum[:])
+
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	return sw.n, sw.err
+}
+
+// ReadIndex loads an index from a snapshot that was written with WriteTo, no tuples are covered
+func ReadIndex(r io.Reader) (*RelationIndex, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < len(snapshotMagic)+4 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("Not an index snapshot.")
+	}
+	body := data[:len(data)-4]
+	if crc32.Checksum(body, snapshotTable) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return nil, errors.New("Index snapshot checksum mismatch.")
+	}
+
+	sr := snapshotReader{body[len(snapshotMagic):], nil}
+	if version := sr.uvarint(); sr.err == nil && version != snapshotVersion {
+		err := fmt.Sprintf("Unsupported index snapshot version %d. Expected %d.", version, snapshotVersion)
+		return nil, errors.New(err)
+	}
+
+	numTuples := int(sr.uvarint())
+	numAttrs := sr.length()
+	typeNames := make([]string, numAttrs)
+	names := make([]string, numAttrs)
+	for i := range typeNames {
+		typeNames[i] = sr.string()
+		names[i] = sr.string()
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+
+	relation, err := NewIndex(typeNames, names, numTuples)
+	if err != nil {
+		return nil, err
+	}
+
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+
+		attr.timeFormat.Layouts = make([]string, sr.length())
+		for i := range attr.timeFormat.Layouts {
+			attr.timeFormat.Layouts[i] = sr.string()
+		}
+		attr.timeFormat.Hours = sr.bool()
+
+		attr.bitmaps = sr.bool()
+		if numWeights := sr.length(); numWeights > 0 {
+			attr.weights = make([]float64, numWeights)
+			for i := range attr.weights {
+				attr.weights[i] = sr.float()
+			}
+		}
+
+		attr.cells = make([]Cell, 0, sr.length())
+		for ic := 0; ic < cap(attr.cells) && sr.err == nil; ic++ {
+			value := sr.string()
+			cell := MakeCell(attr, value, sr.bool())
+			cell.negated = sr.bool()
+
+			tuples := make([]int, sr.length())
+			previous := 0
+			for i := range tuples {
+				tuples[i] = previous + int(sr.uvarint())
+				previous = tuples[i]
+			}
+			for _, tuple := range tuples {
+				if cell.bitmap != nil {
+					if !cell.equalWeights && tuple >= len(attr.weights) {
+						return nil, errCorruptSnapshot
+					}
+					cell.bitmap.tuples.Add(tuple)
+				} else if cell.equalWeights {
+					cell.add(tuple, 1)
+				} else {
+					cell.add(tuple, sr.float())
+				}
+			}
+
+			attr.appendCell(cell)
+		}
+	}
+
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if len(sr.data) > 0 {
+		return nil, errCorruptSnapshot
+	}
+	return relation, nil
+}
+
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32 // checksum of what was written, nil for the checksum itself
+	n   int64       // number of bytes written
+	err error       // first error, nothing is written after an error
+	buf []byte      // scratch space for numbers
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+	if sw.crc != nil {
+		sw.crc.Write(p)
+	}
+	n, err := sw.w.Write(p)
+	sw.n += int64(n)
+	sw.err = err
+}
+
+// bytes returns the scratch space with room for n bytes
+func (sw *snapshotWriter) bytes(n int) []byte {
+	if len(sw.buf) < n {
+		sw.buf = make([]byte, n)
+	}
+	return sw.buf[:n]
+}
+
+func (sw *snapshotWriter) uvarint(x uint64) {
+	buf := sw.bytes(binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, x)
+	sw.write(buf[:n])
+}
+
+func (sw *snapshotWriter) float(f float64) {
+	buf := sw.bytes(8)
+	binary.LittleEndian.PutUint64(buf, math.Float64bits(f))
+	sw.write(buf)
+}
+
+func (sw *snapshotWriter) bool(b bool) {
+	if b {
+		sw.uvarint(1)
+	} else {
+		sw.uvarint(0)
+	}
+}
+
+func (sw *snapshotWriter) string(s string) {
+	sw.uvarint(uint64(len(s)))
+	sw.write([]byte(s))
+}
+
+type snapshotReader struct {
+	data []byte // what was not read yet
+	err  error  // first error, everything reads as zero after an error
+}
+
+func (sr *snapshotReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(sr.data)
+	if n <= 0 {
+		sr.err = errCorruptSnapshot
+		return 0
+	}
+	sr.data = sr.data[n:]
+	return x
+}
+
+// length reads the length of a list, every element takes at least one byte so longer lists are corrupt
+func (sr *snapshotReader) length() int {
+	n := sr.uvarint()
+	if n > uint64(len(sr.data)) {
+		sr.err = errCorruptSnapshot
+		return 0
+	}
+	return int(n)
+}
+
+func (sr *snapshotReader) float() float64 {
+	if sr.err == nil && len(sr.data) < 8 {
+		sr.err = errCorruptSnapshot
+	}
+	if sr.err != nil {
+		return 0
+	}
+	f := math.Float64frombits(binary.LittleEndian.Uint64(sr.data))
+	sr.data = sr.data[8:]
+	return f
+}
+
+func (sr *snapshotReader) bool() bool {
+	return sr.uvarint() != 0
+}
+
+func (sr *snapshotReader) string() string {
+	n := sr.length()
+	if sr.err != nil {
+		return ""
+	}
+	s := string(sr.data[:n])
+	sr.data = sr.data[n:]
+	return s
+}
@@ -0,0 +1,96 @@
+package summarize
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		for _, assessor := range []Assessor{MakeEqualWeightAssessor(), MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})} {
+			relation, err := NewIndexFromString(partitionDescription, assessor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			relation.SetCoverRepresentation(representation)
+			relation.attrs[4].SetTimeFormat(TimeFormat{[]string{"2006-01-02"}, true})
+			relation.AddNegations(0.3)
+
+			var buffer bytes.Buffer
+			n, err := relation.WriteTo(&buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(buffer.Len()) {
+				t.Error("Wrong number of bytes", n, buffer.Len())
+			}
+
+			loaded, err := ReadIndex(&buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if loaded.numTuples != relation.numTuples || len(loaded.attrs) != len(relation.attrs) {
+				t.Fatal("Wrong relation", loaded.numTuples, len(loaded.attrs))
+			}
+			for ia, attr := range relation.attrs {
+				other := loaded.attrs[ia]
+				if other.attributeName != attr.attributeName || other.attributeType != attr.attributeType || other.bitmaps != attr.bitmaps {
+					t.Error("Wrong attribute", other.attributeName, other.attributeType)
+				}
+				if other.values.len() != attr.values.len() || other.timeFormat.Hours != attr.timeFormat.Hours {
+					t.Error("Wrong dictionary or time format", other.attributeName)
+				}
+			}
+
+			expected := fmt.Sprintf("%v", relation.SummarizeWithOptions(5, options))
+			if actual := fmt.Sprintf("%v", loaded.SummarizeWithOptions(5, options)); actual != expected {
+				t.Error("Loaded index should give the same summary", expected, actual)
+			}
+		}
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	relation, err := NewIndexFromString(partitionDescription, MakeEqualWeightAssessor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if _, err := relation.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+
+	if _, err := ReadIndex(bytes.NewReader([]byte("not an index"))); err == nil {
+		t.Error("Should reject other data")
+	}
+	if _, err := ReadIndex(bytes.NewReader(data[:len(data)-1])); err == nil {
+		t.Error("Should reject truncated snapshots")
+	}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)/2] ^= 1
+	if _, err := ReadIndex(bytes.NewReader(corrupt)); err == nil {
+		t.Error("Should reject corrupt snapshots")
+	}
+}
+
+func BenchmarkReadIndex(b *testing.B) {
+	relation := makeRandomRelation(100000, BitmapCovers)
+	var buffer bytes.Buffer
+	if _, err := relation.WriteTo(&buffer); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(buffer.Len()), "snapshot-bytes")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadIndex(bytes.NewReader(buffer.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package summarize
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Column maps a column of a query result to an attribute
+type Column struct {
+	Name      string  // name of the column in the query result
+	Attribute string  // name of the attribute, the name of the column if empty
+	Type      string  // attribute type as in NewIndex
+	Weight    float64 // weight of the attribute for weight functions that use attribute weights
+	Separator string  // splits values of sets and levels of hierarchies, e.g. "," for comma separated authors, a space if empty
+}
+
+// NewIndexFromQuery builds an index from the rows of a query, every row is a tuple
+// NULL and empty values are nulls, the columns are found in the query result by name
+func NewIndexFromQuery(db *sql.DB, columns []Column, function WeightFunc, query string, args ...interface{}) (*RelationIndex, error) {
+	typeNames := make([]string, len(columns))
+	names := make([]string, len(columns))
+	weights := make([]float64, len(columns))
+	for i, column := range columns {
+		typeNames[i] = column.Type
+		names[i] = column.Name
+		if column.Attribute != "" {
+			names[i] = column.Attribute
+		}
+		weights[i] = column.Weight
+	}
+
+	// the number of rows is unknown until all rows were read, the weights are computed again afterwards
+	relation, err := NewIndex(typeNames, names, 0)
+	if err != nil {
+		return nil, err
+	}
+	assessor := Assessor{weights, function, 1, 0.5, 0}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resultColumns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]int, len(columns))
+	for i, column := range columns {
+		positions[i] = -1
+		for j, name := range resultColumns {
+			if name == column.Name {
+				positions[i] = j
+			}
+		}
+		if positions[i] < 0 {
+			err := fmt.Sprintf("Missing column %s in the query result.", column.Name)
+			return nil, errors.New(err)
+		}
+	}
+
+	values := make([]sql.NullString, len(resultColumns))
+	dest := make([]interface{}, len(resultColumns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	tuple := 0
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		assessor.NumTuples = tuple + 1
+
+		for i, column := range columns {
+			value := values[positions[i]]
+			if !value.Valid {
+				continue
+			}
+			if err := relation.attrs[i].addColumnValue(value.String, column.Separator, tuple, assessor); err != nil {
+				return nil, err
+			}
+		}
+		tuple++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	relation.numTuples = tuple
+	relation.reweight(assessor)
+	relation.SetCoverRepresentation(AutomaticCovers)
+	return relation, nil
+}
+
+// addColumnValue adds a raw value of a column, sets and hierarchies are split at the separator
+func (attr *Attribute) addColumnValue(value string, separator string, tuple int, assessor Assessor) error {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		// null
+		return nil
+	}
+	if separator == "" {
+		separator = " "
+	}
+
+	switch attr.attributeType {
+	case single:
+		attr.AddCell(value, tuple, assessor)
+	case set:
+		for _, setValue := range strings.Split(value, separator) {
+			if setValue = strings.TrimSpace(setValue); len(setValue) > 0 {
+				attr.AddCell(setValue, tuple, assessor)
+			}
+		}
+	case hierarchy:
+		var levels []string
+		for _, level := range strings.Split(value, separator) {
+			if level = strings.TrimSpace(level); len(level) > 0 {
+				levels = append(levels, level)
+			}
+		}
+		attr.addPath(levels, tuple, assessor)
+	case timestamp:
+		return attr.AddTime(value, tuple, assessor)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package summarize
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDatabase(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements := []string{
+		"create table papers (id integer, authors text, venue text, year integer, topic text, published text)",
+		"insert into papers values (1, 'Gray, Stonebraker', 'SIGMOD', 2015, 'db/systems', '2015-01-02')",
+		"insert into papers values (2, 'Gray', 'SIGMOD', 2014, 'db', '2014-06-01')",
+		"insert into papers values (3, 'Stonebraker ,, Codd', NULL, 2015, 'db/theory', NULL)",
+		"insert into papers values (4, NULL, 'VLDB', NULL, '', '2015-01-03')",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestIndexFromQuery(t *testing.T) {
+	db := openTestDatabase(t)
+	defer db.Close()
+
+	columns := []Column{
+		{"authors", "author", "set", 1, ","},
+		{"venue", "", "single", 0.7, ""},
+		{"year", "", "single", 0.1, ""},
+		{"topic", "", "hierarchy", 0.5, "/"},
+		{"published", "", "time", 0.3, ""},
+	}
+	relation, err := NewIndexFromQuery(db, columns, Exponential, "select * from papers where id < ? order by id", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	description := "set,single,single,hierarchy,time\nauthor,venue,year,topic,published\nGray Stonebraker,SIGMOD,2015,db systems,2015-01-02\nGray,SIGMOD,2014,db,2014-06-01\nStonebraker Codd,,2015,db theory,\n,VLDB,,,2015-01-03"
+	expected, err := NewIndexFromString(description, MakeExponentialAssessor([]float64{1, 0.7, 0.1, 0.5, 0.3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if relation.numTuples != 4 {
+		t.Error("Wrong number of tuples", relation.numTuples)
+	}
+	if describeCells(relation) != describeCells(expected) {
+		t.Error("Query should give the same index", describeCells(relation), describeCells(expected))
+	}
+	for ia, attr := range expected.attrs {
+		if relation.attrs[ia].attributeName != attr.attributeName || relation.attrs[ia].attributeType != attr.attributeType {
+			t.Error("Wrong attribute", relation.attrs[ia].attributeName, relation.attrs[ia].attributeType)
+		}
+	}
+}
+
+func TestIndexFromQueryErrors(t *testing.T) {
+	db := openTestDatabase(t)
+	defer db.Close()
+
+	if _, err := NewIndexFromQuery(db, []Column{{"missing", "", "single", 1, ""}}, Equal, "select * from papers"); err == nil {
+		t.Error("Should fail for missing columns")
+	}
+	if _, err := NewIndexFromQuery(db, []Column{{"venue", "", "single", 1, ""}}, Equal, "select * from nothing"); err == nil {
+		t.Error("Should fail for invalid queries")
+	}
+	if _, err := NewIndexFromQuery(db, []Column{{"venue", "", "time", 1, ""}}, Equal, "select * from papers"); err == nil {
+		t.Error("Should fail for invalid times")
+	}
+}
@@ -2,10 +2,15 @@ package summarize
 
 import (
 	"container/heap"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
 	"sort"
+	"strings"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -13,60 +18,161 @@ import (
 // var info = log.New(os.Stdout, "INFO: ", log.Lshortfile)
 var dbg = log.New(os.Stdout, "DEBUG: ", log.Lshortfile)
 
+// number of cells that each worker evaluates per batch in the parallel search
+const cellsPerWorker = 4
+
 // Value is an assignment for the summary
 type Value struct {
-	attributeType Type   // attribute type
-	attributeName string // attribute name
-	value         string // value
+	attributeType Type     // attribute type
+	attributeName string   // attribute name
+	value         string   // value
+	negated       bool     // whether the value is excluded rather than required
+	disjuncts     []string // alternative values
+}
+
+// MakeValue makes a value of an attribute to look up in an index, e.g. to pin it in the options
+func MakeValue(attribute string, value string, negated bool) Value {
+	return Value{single, attribute, value, negated, nil}
+}
+
+// AttributeName returns the name of the attribute
+func (value Value) AttributeName() string {
+	return value.attributeName
+}
+
+// AttributeType returns the type of the attribute
+func (value Value) AttributeType() Type {
+	return value.attributeType
+}
+
+// Value returns the value
+func (value Value) Value() string {
+	return value.value
+}
+
+// Negated returns whether the value is excluded rather than required
+func (value Value) Negated() bool {
+	return value.negated
+}
+
+// Disjuncts returns the alternative values
+func (value Value) Disjuncts() []string {
+	return value.disjuncts
+}
+
+// MarshalJSON encodes a value as an object with the attribute
+func (value Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Attribute string   `json:"attribute"`
+		Type      string   `json:"type"`
+		Value     string   `json:"value"`
+		Negated   bool     `json:"negated,omitempty"`
+		Disjuncts []string `json:"disjuncts,omitempty"`
+	}{value.attributeName, value.attributeType.String(), value.value, value.negated, value.disjuncts})
+}
+
+// UnmarshalJSON decodes a value from an object with the attribute, the type is optional
+func (value *Value) UnmarshalJSON(data []byte) error {
+	var object struct {
+		Attribute string   `json:"attribute"`
+		Type      string   `json:"type"`
+		Value     string   `json:"value"`
+		Negated   bool     `json:"negated"`
+		Disjuncts []string `json:"disjuncts"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+
+	*value = Value{single, object.Attribute, object.Value, object.Negated, object.Disjuncts}
+	for _, t := range []Type{single, set, hierarchy, timestamp} {
+		if t.String() == object.Type {
+			value.attributeType = t
+		}
+	}
+	return nil
 }
 
 // Summary is a summary
 type Summary [][]Value
 
+// formulaKey identifies the formula of a summary independently of the order in which its cells were added
+func formulaKey(values []Value) string {
+	sorted := make([]Value, len(values))
+	for i, value := range values {
+		sorted[i] = value
+		sorted[i].disjuncts = append([]string{}, value.disjuncts...)
+		sort.Strings(sorted[i].disjuncts)
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].attributeName != sorted[b].attributeName {
+			return sorted[a].attributeName < sorted[b].attributeName
+		}
+		if sorted[a].value != sorted[b].value {
+			return sorted[a].value < sorted[b].value
+		}
+		return !sorted[a].negated && sorted[b].negated
+	})
+	return fmt.Sprint(sorted)
+}
+
 // SummaryResult packs a summary
 type SummaryResult struct {
-	Summary      Summary   // the summary
-	FormulaCover []float64 // how much each formula covers
-	SummaryCover float64   // sum of tupleCover
+	Summary      Summary         // the summary
+	FormulaCover []float64       // how much each formula covers
+	SummaryCover float64         // sum of tupleCover
+	Alternatives [][]Alternative `json:",omitempty"` // the next best formulas that the search considered instead of each formula, only if Options.Alternatives is set
 }
 
-func makeRankedCells(relation RelationIndex) CellHeap {
+func makeRankedCells(relation RelationIndex, options Options) CellHeap {
 	var rankedCells CellHeap
 	index := 0
 	for _, attr := range relation.attrs {
 		for i := range attr.cells {
 			cell := &attr.cells[i]
+			if cell.negated && options.MaxNegations <= 0 {
+				continue
+			}
+			if options.Deterministic {
+				cell.sortTuples()
+			} else {
+				cell.tuples = nil
+			}
 			potential := cell.SumWeights()
 			// TODO: we may be able to ignore cells if we add regularization
-			rankedCell := RankedCell{cell, potential, potential, index}
+			rankedCell := RankedCell{cell, potential, potential, index, index}
 			rankedCells = append(rankedCells, &rankedCell)
 			index++
 		}
 	}
-	return rankedCells
-}
 
-// makes copies of pointers
-func copyRankedCells(rankedCells CellHeap) CellHeap {
-	cellsCopy := make(CellHeap, len(rankedCells))
-	for i, cell := range rankedCells {
-		cellCopy := new(RankedCell)
-		*cellCopy = *cell
-		cellsCopy[i] = cellCopy
-	}
-	return cellsCopy
+	rankedCells.rank(options.TieBreak)
+
+	return rankedCells
 }
 
 // returns the best cell form a list of cells with potentials
 // requires that the cells are a sorted heap
-func updateBestCellHeap(cellHeap *CellHeap) (bool, *RankedCell) {
+// if considered is not nil, the formulas of single cells are alternatives and cells are recomputed until the best alternatives are known
+// tuples that were covered before count with the given overlap
+func updateBestCellHeap(cellHeap *CellHeap, overlap float64, considered *alternatives) (bool, *RankedCell) {
 	bestCover := 0.0
 	var bestCell *RankedCell
 
-	for len(*cellHeap) > 0.0 && cellHeap.Peek().potential > bestCover {
+	// cells whose cover is known are taken off the heap while looking for alternatives, otherwise the top would not change
+	var recomputed []*RankedCell
+
+	for len(*cellHeap) > 0.0 && (cellHeap.Peek().potential > bestCover || considered.wants(cellHeap.Peek().potential)) {
 		cell := cellHeap.Peek()
-		cover := cell.recomputeCoverage()
-		heap.Fix(cellHeap, cell.index)
+		cover := cell.recomputeCoverage(overlap)
+		if considered != nil {
+			if cover > 0 {
+				considered.consider(nil, cell.cell, cover)
+			}
+			recomputed = append(recomputed, heap.Pop(cellHeap).(*RankedCell))
+		} else {
+			heap.Fix(cellHeap, cell.index)
+		}
 
 		if cover > bestCover {
 			bestCover = cover
@@ -74,35 +180,93 @@ func updateBestCellHeap(cellHeap *CellHeap) (bool, *RankedCell) {
 		}
 	}
 
+	for _, cell := range recomputed {
+		heap.Push(cellHeap, cell)
+	}
+
 	return bestCover > 0.0 && len(*cellHeap) > 0, bestCell
 }
 
+// evaluateFormulaCell recomputes the potential of a cell in the context of a formula
+// returns false if the cell cannot be used in this formula and should be removed from its heap
+// only changes the ranked cell so that cells can be evaluated concurrently
+func evaluateFormulaCell(cell *RankedCell, formula *Formula, options Options) bool {
+	if formula.pinned > 0 && formula.pins(*cell.cell) {
+		// the cell is already in the formula
+		return false
+	}
+
+	if i := formula.disjunction(*cell.cell); i >= 0 {
+		if i < formula.pinned || len(formula.cells[i].disjuncts)+1 >= options.MaxDisjuncts {
+			// the formula already has as many values assigned to this attribute as it may have
+			return false
+		}
+
+		cell.recomputeDisjunctionCoverage(formula, i)
+
+		// the value does not add any tuples that match the rest of the formula if there is no potential
+		return cell.maxPotential > 0
+	}
+
+	if cell.cell.attribute.attributeType == single && formula.usedSingleAttributes.Has(cell.cell.attribute.index) {
+		// the formula already has a value assigned to this attribute
+		return false
+	}
+
+	if cell.cell.attribute.attributeType == single && !cell.cell.negated && formula.negates(cell.cell.attribute.index) {
+		// a value is redundant if the formula already excludes values of this attribute
+		return false
+	}
+
+	if cell.cell.negated && formula.negations >= options.MaxNegations {
+		// the formula cannot have more negations
+		return false
+	}
+
+	if cell.cell.negated && !formula.narrows(*cell.cell) {
+		// the negation is implied by the formula
+		return false
+	}
+
+	cell.recomputeFormulaCoverage(formula)
+
+	// looks like there is no overlap between what tuples the formula and the cell cover if there is no potential
+	// this means we can remove it because this cell will not be usable for this formula
+	return cell.maxPotential > 0
+}
+
+// better returns whether a cell is better than the best cell so far
+// ties are broken by the order of the cells so that the result does not depend on the order of evaluation
+func better(cell *RankedCell, bestCover float64, bestCell *RankedCell) bool {
+	return cell.potential > bestCover || (bestCell != nil && cell.potential == bestCover && cell.order < bestCell.order)
+}
+
 // returns nil if no cell could be found that improves the formula
 // requires cells to be a heap
-func updateFormulaBestCellHeap(formulaCellHeap *CellHeap, formula *Formula) (bool, *RankedCell) {
+// the formula with each evaluated cell is considered as an alternative if considered is not nil
+func updateFormulaBestCellHeap(formulaCellHeap *CellHeap, formula *Formula, options Options, considered *alternatives) (bool, *RankedCell) {
+	if options.Workers > 1 {
+		return updateFormulaBestCellHeapParallel(formulaCellHeap, formula, options, considered)
+	}
+
 	// the largest change that a cell can do
 	bestCover := 0.0
 	var bestCell *RankedCell
 
-	for len(*formulaCellHeap) > 0 && formulaCellHeap.Peek().potential > bestCover {
+	for len(*formulaCellHeap) > 0 && better(formulaCellHeap.Peek(), bestCover, bestCell) {
 		cell := formulaCellHeap.Peek()
-		if cell.cell.attribute.attributeType == single && formula.usedSingleAttributes.Has(cell.cell.attribute.index) {
-			// the formula already has a value assigned to this attribute
+
+		if !evaluateFormulaCell(cell, formula, options) {
 			heap.Pop(formulaCellHeap)
 			continue
 		}
 
-		cellCover := cell.recomputeFormulaCoverage(formula)
-
-		if cell.maxPotential <= 0 {
-			// looks like there is no overlap between what tuples the formula and the cell cover
-			// this means we can remove it because this cell will not be usable for this formula
-			heap.Pop(formulaCellHeap)
-			continue
+		if considered != nil && formula.cover+cell.potential > 0 {
+			considered.consider(formula, cell.cell, formula.cover+cell.potential)
 		}
 
-		if cellCover > bestCover {
-			bestCover = cellCover
+		if better(cell, bestCover, bestCell) {
+			bestCover = cell.potential
 			bestCell = cell
 		}
 
@@ -112,54 +276,225 @@ func updateFormulaBestCellHeap(formulaCellHeap *CellHeap, formula *Formula) (boo
 	return bestCover > 0 && len(*formulaCellHeap) > 0, bestCell
 }
 
+// same as updateFormulaBestCellHeap but evaluates the most promising cells in batches on multiple workers
+// the result and the alternatives are the same because only the cells that the sequential search would evaluate are used,
+// the others in a batch get their potentials back and return to the heap
+func updateFormulaBestCellHeapParallel(formulaCellHeap *CellHeap, formula *Formula, options Options, considered *alternatives) (bool, *RankedCell) {
+	bestCover := 0.0
+	var bestCell *RankedCell
+
+	batchSize := options.Workers * cellsPerWorker
+	batch := make([]*RankedCell, 0, batchSize)
+	keep := make([]bool, batchSize)
+	bounds := make([]RankedCell, batchSize)
+
+	for len(*formulaCellHeap) > 0 && better(formulaCellHeap.Peek(), bestCover, bestCell) {
+		// take the cells off the heap that the sequential search would look at next
+		batch = batch[:0]
+		for len(*formulaCellHeap) > 0 && len(batch) < batchSize && better(formulaCellHeap.Peek(), bestCover, bestCell) {
+			cell := heap.Pop(formulaCellHeap).(*RankedCell)
+			bounds[len(batch)] = *cell
+			batch = append(batch, cell)
+		}
+
+		parallel(len(batch), options.Workers, func(i int) {
+			keep[i] = evaluateFormulaCell(batch[i], formula, options)
+		})
+
+		// walk the batch in heap order, the sequential search stops at the first cell that cannot be better than the best one
+		stopped := false
+		for i, cell := range batch {
+			stopped = stopped || !better(&bounds[i], bestCover, bestCell)
+			if stopped {
+				cell.potential, cell.maxPotential = bounds[i].potential, bounds[i].maxPotential
+				heap.Push(formulaCellHeap, cell)
+				continue
+			}
+
+			// put back the cells that can still be used
+			if !keep[i] {
+				continue
+			}
+			if considered != nil && formula.cover+cell.potential > 0 {
+				considered.consider(formula, cell.cell, formula.cover+cell.potential)
+			}
+			if better(cell, bestCover, bestCell) {
+				bestCover = cell.potential
+				bestCell = cell
+			}
+			heap.Push(formulaCellHeap, cell)
+		}
+	}
+
+	return bestCover > 0 && len(*formulaCellHeap) > 0, bestCell
+}
+
+// Summarizer is an index that summaries can be computed from
+type Summarizer interface {
+	Summarize(size int) SummaryResult
+	SummarizeWithOptions(size int, options Options) SummaryResult
+	SummarizeContext(ctx context.Context, size int, options Options) (SummaryResult, error)
+	Reset()
+}
+
 // Summarize summarizes
 func (relation RelationIndex) Summarize(size int) SummaryResult {
+	return relation.SummarizeWithOptions(size, DefaultOptions)
+}
+
+// SummarizeWithOptions summarizes with the given search options, the summary is empty if Check rejects the options
+func (relation RelationIndex) SummarizeWithOptions(size int, options Options) SummaryResult {
+	result, _ := relation.summarize(context.Background(), size, options, true, nil)
+	return result
+}
+
+// SummarizeContext summarizes until the summary is complete or the context is done
+// if the context is done, the formulas that were found so far are returned with the error of the context
+// invalid options give an empty summary and the error of Check
+func (relation RelationIndex) SummarizeContext(ctx context.Context, size int, options Options) (SummaryResult, error) {
+	return relation.summarize(ctx, size, options, true, nil)
+}
+
+// summarize summarizes, formula candidates are restricted to cells that share tuples with the formula if cooccurrence is true
+// the excluded formulas are not added to the summary, in whatever order their cells are
+func (relation RelationIndex) summarize(ctx context.Context, size int, options Options, cooccurrence bool, excluded Summary) (SummaryResult, error) {
 	var formulaCover []float64
 	summaryCover := 0.0
 	var summary Summary
+	var alternatives [][]Alternative
+
+	if err := options.Check(); err != nil {
+		return SummaryResult{}, err
+	}
 
-	rankedCells := makeRankedCells(relation)
+	rankedCells := makeRankedCells(relation, options)
 	heap.Init(&rankedCells)
 
-	for len(summary) < size {
-		// add new formula with best cell
-		goodFormula, cell := updateBestCellHeap(&rankedCells)
+	formulaCandidates := newCandidates(rankedCells, cooccurrence)
+	formulaCandidates.overlap = options.Overlap > 0
 
-		if !goodFormula {
-			break
+	// formulas that are excluded or in the summary, the same formula can only be the best again if covers overlap
+	seen := make(map[string]bool)
+	for _, values := range excluded {
+		seen[formulaKey(values)] = true
+	}
+
+	// formulas with pinned cells or required attributes do not start with the best cell
+	constrained := len(options.Pinned) > 0 || len(options.Required) > 0
+
+	// blocked cells are taken off the heap until the next formula is added so that no formula starts with them
+	var parked []*RankedCell
+	// whether the formula of only the pinned cells was seen, then the formulas get another cell even if it makes them worse
+	bare := false
+	unblock := func() {
+		for _, cell := range parked {
+			heap.Push(&rankedCells, cell)
+		}
+		parked = parked[:0]
+		bare = false
+		formulaCandidates.unblock()
+	}
+
+	// the formulas that the search considers for the next formula of the summary, nil if they are not returned
+	considered := newAlternatives(options.Alternatives)
+
+	for len(summary) < size {
+		if err := ctx.Err(); err != nil {
+			return SummaryResult{summary, formulaCover, summaryCover, alternatives}, err
 		}
 
-		// create formula from best cell
-		formula := NewFormula(*cell.cell)
+		var formula *Formula
+		var formulaRankedCells *CellHeap
+		// the order of the cell that was added last, -1 if the formula only has pinned cells
+		last := -1
+		if constrained {
+			formula, formulaRankedCells, last = relation.startConstrained(&rankedCells, formulaCandidates, options)
+			if formula == nil {
+				break
+			}
+			if bare && last < 0 {
+				cell := bestCell(formulaRankedCells, formula, options, func(*Cell) bool { return true })
+				if cell == nil {
+					break
+				}
+				extendFormula(formula, cell, formulaRankedCells, formulaCandidates)
+				last = cell.order
+			}
+		} else {
+			// add new formula with best cell
+			goodFormula, cell := updateBestCellHeap(&rankedCells, options.Overlap, considered)
 
-		// make a copy of the ranked cells, we can use this now in the context of a formula and remove elements and reorder
-		// note that CellHeap has pointers so we can safely modify the slice but not the cells it points to
-		formulaRankedCells := copyRankedCells(rankedCells)
+			if !goodFormula {
+				break
+			}
 
-		// remove the cell we used to build a formula because we won't use it any more
-		// remove only from the heap for this formula but not in general
-		heap.Remove(&formulaRankedCells, cell.index)
+			// create formula from best cell
+			last = cell.order
+			formula = newFormula(*cell.cell, options.Overlap)
+
+			// copy the ranked cells that share tuples with the formula, we can use them now in the context of a formula and remove elements and reorder
+			// the cell we used to build a formula is not a candidate because we won't use it any more
+			formulaRankedCells = formulaCandidates.start(cell, options)
+			heap.Init(formulaRankedCells)
+		}
 
 		// keep adding to formula
 		for true {
-			improved, cell := updateFormulaBestCellHeap(&formulaRankedCells, formula)
+			// the formula is dropped if the context is done before it is complete
+			if err := ctx.Err(); err != nil {
+				return SummaryResult{summary, formulaCover, summaryCover, alternatives}, err
+			}
+
+			improved, cell := updateFormulaBestCellHeap(formulaRankedCells, formula, options, considered)
 
 			// there may not be an improvement if adding the formula reduces its applicability
 			if !improved {
 				break
 			}
 
-			// add cell to formula
-			formula.AddCell(*cell.cell)
+			extendFormula(formula, cell, formulaRankedCells, formulaCandidates)
+			last = cell.order
+		}
 
-			// remove the cell from the heap because we used it in this formula
-			heap.Remove(&formulaRankedCells, cell.index)
+		// a formula that started with a negation does not keep it if a later cell implies it
+		grown := formula
+		if formula.negations > 0 {
+			formula = formula.withoutImpliedNegations()
+		}
 
-			// have to reset the potentials because we will reduce the set of tuples that the formula covers
-			for i := range formulaRankedCells {
-				formulaRankedCells[i].potential = formulaRankedCells[i].maxPotential
+		// the pinned cells and required attributes may not cover anything any more
+		if constrained && formula.cover <= 0 {
+			break
+		}
+
+		// add formula to summary
+		var values []Value
+		for _, cell := range formula.cells {
+			value := Value{cell.attribute.attributeType, cell.attribute.attributeName, cell.value(), cell.negated, cell.disjuncts}
+			values = append(values, value)
+		}
+
+		// a formula that is excluded or already in the summary is searched again without the cell that was added last
+		if options.Overlap > 0 || len(seen) > 0 {
+			key := formulaKey(values)
+			if seen[key] {
+				if last < 0 {
+					// the formula only has the pinned cells
+					bare = true
+					continue
+				}
+				if cell := formulaCandidates.block(last); cell != nil {
+					heap.Remove(&rankedCells, cell.index)
+					parked = append(parked, cell)
+				}
+				if considered != nil {
+					considered.reset()
+				}
+				continue
+			}
+			if options.Overlap > 0 {
+				seen[key] = true
 			}
-			heap.Init(&formulaRankedCells)
 		}
 
 		// set cover in index
@@ -170,34 +505,161 @@ func (relation RelationIndex) Summarize(size int) SummaryResult {
 
 		// if the formula has only one cell, we can pop that one off the heap because nothing can every use it again
 		// we cannot remove it in other cases because the same cell may be used again
-		if len(formula.cells) == 1 {
-			if rankedCells.Peek().cell.value != formula.cells[0].value {
+		// constrained formulas do not start with the top of the heap
+		// the negation that the formula started with may have been dropped
+		if len(formula.cells) == 1 && !constrained && formula == grown {
+			if rankedCells.Peek().cell.id != formula.cells[0].id {
 				panic("The value of first cell should be the same as the value of the cell in the formula if the formula has only one cell.")
 			}
 			heap.Pop(&rankedCells)
 		}
+		unblock()
 
-		// add formula to summary
-		var values []Value
-		for _, cell := range formula.cells {
-			value := Value{cell.attribute.attributeType, cell.attribute.attributeName, cell.value}
-			values = append(values, value)
-		}
 		summary = append(summary, values)
+		if considered != nil {
+			alternatives = append(alternatives, considered.finish(values))
+		}
 	}
 
 	return SummaryResult{
 		summary,
 		formulaCover,
 		summaryCover,
+		alternatives,
+	}, nil
+}
+
+// extendFormula adds a cell to a formula, removes it from the heap and resets the potentials of the other cells
+func extendFormula(formula *Formula, cell *RankedCell, formulaRankedCells *CellHeap, formulaCandidates *candidates) {
+	// adding an alternative value extends the set of tuples that the formula covers
+	extends := formula.disjunction(*cell.cell) >= 0
+
+	// add cell to formula
+	formula.AddCell(*cell.cell)
+
+	// remove the cell from the heap because we used it in this formula
+	heap.Remove(formulaRankedCells, cell.index)
+
+	// cells that share tuples with the new value can now improve the formula
+	if extends {
+		formulaCandidates.addCooccurring(cell.cell)
+	}
+
+	// have to reset the potentials because we will reduce the set of tuples that the formula covers
+	for _, c := range *formulaRankedCells {
+		if formula.disjunction(*c.cell) >= 0 {
+			// every new cell in the formula adds weight to the tuples that an alternative value can add
+			// so the last gain is no upper bound any more
+			c.potential = math.Inf(1)
+		} else if extends {
+			// the formula covers more tuples so what a cell could cover in the context of the formula is no upper bound any more
+			c.potential = c.recomputeCoverage(formula.overlap)
+		} else {
+			c.potential = c.maxPotential
+		}
+	}
+	heap.Init(formulaRankedCells)
+}
+
+// startConstrained starts a formula with the pinned cells and a value of every required attribute
+// returns nil if there is no such formula that covers anything, and the order of the cell that was added last or -1 if there is none
+func (relation RelationIndex) startConstrained(rankedCells *CellHeap, formulaCandidates *candidates, options Options) (*Formula, *CellHeap, int) {
+	var formula *Formula
+	var formulaRankedCells *CellHeap
+	last := -1
+
+	if len(options.Pinned) > 0 {
+		pinned, has := relation.formula(options.Pinned, options.Overlap)
+		if !has {
+			return nil, nil, -1
+		}
+		formula = pinned
+		formula.pinned = len(formula.cells)
+		formulaRankedCells = formulaCandidates.startPinned(&formula.cells[0])
+	} else {
+		seed := requiredSeed(rankedCells, options.Required, options.Overlap)
+		if seed == nil {
+			return nil, nil, -1
+		}
+		formula = newFormula(*seed.cell, options.Overlap)
+		last = seed.order
+		formulaRankedCells = formulaCandidates.start(seed, options)
 	}
+	heap.Init(formulaRankedCells)
+
+	// the best value of a missing attribute is added even if it makes the formula worse
+	for formula.lacks(options.Required) {
+		cell := requiredCell(formulaRankedCells, formula, options)
+		if cell == nil {
+			return nil, nil, -1
+		}
+		extendFormula(formula, cell, formulaRankedCells, formulaCandidates)
+		last = cell.order
+	}
+
+	return formula, formulaRankedCells, last
+}
+
+// requiredSeed returns the positive cell of a required attribute that covers the most, nil if none covers anything
+func requiredSeed(rankedCells *CellHeap, required []string, overlap float64) *RankedCell {
+	var seed *RankedCell
+	for _, cell := range *rankedCells {
+		if cell.cell.negated || !contains(required, cell.cell.attribute.attributeName) {
+			continue
+		}
+		cell.recomputeCoverage(overlap)
+		if cell.potential > 0 && (seed == nil || better(cell, seed.potential, seed)) {
+			seed = cell
+		}
+	}
+	heap.Init(rankedCells)
+	return seed
+}
+
+// requiredCell returns the positive cell of an attribute that the formula lacks that improves it the most or makes it the least worse
+// returns nil if no such cell covers anything in the context of the formula
+func requiredCell(formulaCellHeap *CellHeap, formula *Formula, options Options) *RankedCell {
+	return bestCell(formulaCellHeap, formula, options, func(cell *Cell) bool {
+		name := cell.attribute.attributeName
+		return !cell.negated && contains(options.Required, name) && !formula.has(name)
+	})
+}
+
+// bestCell returns the accepted cell that improves the formula the most or makes it the least worse
+// returns nil if no such cell covers anything in the context of the formula
+func bestCell(formulaCellHeap *CellHeap, formula *Formula, options Options, accept func(*Cell) bool) *RankedCell {
+	var best *RankedCell
+	for _, cell := range *formulaCellHeap {
+		if !accept(cell.cell) {
+			continue
+		}
+		if evaluateFormulaCell(cell, formula, options) && (best == nil || better(cell, best.potential, best)) {
+			best = cell
+		}
+	}
+	heap.Init(formulaCellHeap)
+	return best
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
 }
 
 // DebugPrint prints a summary
 func (summary SummaryResult) DebugPrint() {
-	fmt.Printf("Summary (cover: %g):\n", summary.SummaryCover)
+	summary.Fprint(os.Stdout)
+}
 
-	table := tablewriter.NewWriter(os.Stdout)
+// Fprint writes a summary as a table
+func (summary SummaryResult) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "Summary (cover: %g):\n", summary.SummaryCover)
+
+	table := tablewriter.NewWriter(w)
 
 	// provides positions
 	header := make(map[string]int)
@@ -237,15 +699,31 @@ func (summary SummaryResult) DebugPrint() {
 					prefix = ", "
 				}
 				values[header[key]] += prefix + cell.value
-			case hierarchy:
+			case hierarchy, timestamp:
 				if len(values[header[key]]) < len(cell.value) {
 					values[header[key]] = cell.value
 				}
 			case single:
-				values[header[key]] = cell.value
+				if cell.negated {
+					prefix := ""
+					if len(values[header[key]]) > 0 {
+						prefix = ", "
+					}
+					values[header[key]] += prefix + "!= " + cell.value
+				} else if len(cell.disjuncts) > 0 {
+					values[header[key]] = fmt.Sprintf("{%s}", strings.Join(append([]string{cell.value}, cell.disjuncts...), ", "))
+				} else {
+					values[header[key]] = cell.value
+				}
 			}
 
 		}
+		// render time values at their most specific level
+		for key, i := range header {
+			if strings.HasSuffix(key, fmt.Sprintf("(%s)", timestamp)) && len(values[i]) > 0 {
+				values[i] = humanizeTime(values[i])
+			}
+		}
 		values[len(values)-1] = fmt.Sprintf("%d", len(cells))
 		table.Append(values)
 	}
@@ -0,0 +1,525 @@
+package summarize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNegations(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single\nv\na\na\na\na\nb\nc\nd", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relation.AddNegations(0.5)
+
+	summary := relation.Summarize(2)
+	if summary.Summary[1][0].negated {
+		t.Error("Negations should be disabled by default")
+	}
+
+	relation.Reset()
+	summary = relation.SummarizeWithOptions(2, Options{MaxNegations: 1})
+
+	first := summary.Summary[0][0]
+	if first.value != "a" || first.negated {
+		t.Error("First formula should be v = a", first)
+	}
+	second := summary.Summary[1][0]
+	if second.value != "a" || !second.negated {
+		t.Error("Second formula should be v != a", second)
+	}
+	if summary.FormulaCover[1] != 3 {
+		t.Error("Wrong cover", summary.FormulaCover[1])
+	}
+}
+
+func TestImpliedNegations(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single\nvenue,year\nSIGMOD,2015\nSIGMOD,2014\nSIGMOD,2015\nVLDB,2013\nVLDB,2013\nICDE,2015", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relation.AddNegations(0.1)
+
+	summary := relation.SummarizeWithOptions(3, Options{MaxNegations: 1, Deterministic: true})
+	for i, formula := range summary.Summary {
+		var positive []Value
+		for _, value := range formula {
+			if !value.negated {
+				positive = append(positive, value)
+			}
+		}
+		if len(positive) < len(formula) && len(positive) > 0 && len(relation.Members(positive)) == len(relation.Members(formula)) {
+			t.Error("Formulas should not have negations that the other values imply", formula)
+		}
+		if summary.FormulaCover[i] > float64(len(formula)*len(relation.Members(formula))) {
+			t.Error("Wrong cover", formula, summary.FormulaCover[i])
+		}
+	}
+}
+
+func TestNegationsOnlyDominantValues(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single\nv\na\na\nb\n", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relation.AddNegations(0.5)
+	relation.AddNegations(0.5)
+
+	negations := 0
+	for _, cell := range relation.attrs[0].cells {
+		if cell.negated {
+			negations++
+			if cell.value() != "a" || cell.size() != 1 {
+				t.Error("Wrong negated cell", cell)
+			}
+		}
+	}
+	if negations != 1 {
+		t.Error("Expected one negated cell", negations)
+	}
+}
+
+func TestDisjunctions(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single\nvenue,year\nSIGMOD,2015\nSIGMOD,2014\nSIGMOD,2013\nSIGMOD,2012\nVLDB,2015\nVLDB,2014\nVLDB,2013\nICDE,2015", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := relation.SummarizeWithOptions(1, Options{MaxDisjuncts: 2})
+
+	formula := summary.Summary[0]
+	if len(formula) != 1 {
+		t.Fatal("Formula should have one cell", formula)
+	}
+	if formula[0].value != "SIGMOD" || len(formula[0].disjuncts) != 1 || formula[0].disjuncts[0] != "VLDB" {
+		t.Error("Formula should be venue in {SIGMOD, VLDB}", formula[0])
+	}
+	if summary.FormulaCover[0] != 7 {
+		t.Error("Wrong cover", summary.FormulaCover[0])
+	}
+
+	relation.Reset()
+	summary = relation.SummarizeWithOptions(2, Options{MaxDisjuncts: 3})
+	if summary.FormulaCover[0] != 8 {
+		t.Error("Wrong cover", summary.FormulaCover[0])
+	}
+	// year in {2015, 2014, 2013}
+	if summary.FormulaCover[1] != 7 {
+		t.Error("Wrong cover", summary.FormulaCover[1])
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	description := "single,single,set,hierarchy\nw,x,y,z\na,b,c d f,a b c\na,b,c,a b\na,b,c,a b c\nb,,d e f,a b\na,b,c e,\na,a,,a\nc,d,f d,a c\nc,a,e,b\nb,d,c f,a c"
+	options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+
+	var expected string
+	for i := 0; i < 20; i++ {
+		assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9})
+		relation, err := NewIndexFromString(description, assessor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		relation.AddNegations(0.3)
+
+		result := fmt.Sprintf("%v", relation.SummarizeWithOptions(5, options))
+		if i == 0 {
+			expected = result
+		} else if result != expected {
+			t.Fatal("Summaries differ between runs", expected, result)
+		}
+	}
+}
+
+func TestBitmapCovers(t *testing.T) {
+	description := "single,single,set,hierarchy,time\nw,x,y,z,t\na,b,c d f,a b c,2015-01-02\na,b,c,a b,2015-02-03\na,b,c,a b c,2016-01-02\nb,,d e f,a b,\na,b,c e,,2015-01-03\na,a,,a,2014-12-30\nc,d,f d,a c,2016-05-06\nc,a,e,b,2016-05-07\nb,d,c f,a c,2015-01-01"
+	options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+
+	summarize := func(representation CoverRepresentation) string {
+		assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})
+		relation, err := NewIndexFromString(description, assessor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		relation.SetCoverRepresentation(representation)
+		relation.AddNegations(0.3)
+
+		result := fmt.Sprintf("%v", relation.SummarizeWithOptions(5, options))
+		relation.Reset()
+		if fmt.Sprintf("%v", relation.SummarizeWithOptions(5, options)) != result {
+			t.Error("Reset should restore the index")
+		}
+		return result
+	}
+
+	maps := summarize(MapCovers)
+	bitmaps := summarize(BitmapCovers)
+	if maps != bitmaps {
+		t.Error("Representations should give the same summary", maps, bitmaps)
+	}
+}
+
+// makeRandomRelation makes a relation like the one in the profile command
+func makeRandomRelation(numTuples int, representation CoverRepresentation) *RelationIndex {
+	random := rand.New(rand.NewSource(42))
+	assessor := MakeExponentialAssessor([]float64{0.5, 0.5, 0.5, 0.5, 0.5})
+	assessor.NumTuples = numTuples
+
+	relation, _ := NewIndex([]string{"single", "single", "single", "set", "set"}, []string{"s0", "s1", "s2", "set0", "set1"}, numTuples)
+	relation.SetCoverRepresentation(representation)
+
+	for i := 0; i < numTuples; i++ {
+		relation.attrs[0].AddCell(fmt.Sprint(random.Intn(100)), i, assessor)
+		relation.attrs[1].AddCell(fmt.Sprint(random.Intn(1000)), i, assessor)
+		relation.attrs[2].AddCell(fmt.Sprint(random.Intn(numTuples)), i, assessor)
+		for j := 0; j < 3; j++ {
+			relation.attrs[3].AddCell(fmt.Sprint(random.Intn(200)), i, assessor)
+		}
+		for j := 0; j < 6; j++ {
+			relation.attrs[4].AddCell(fmt.Sprint(random.Intn(50)), i, assessor)
+		}
+	}
+	return relation
+}
+
+func benchmarkSummarize(b *testing.B, representation CoverRepresentation, options Options) {
+	relation := makeRandomRelation(100000, representation)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		relation.SummarizeWithOptions(50, options)
+		relation.Reset()
+	}
+}
+
+func BenchmarkSummarizeMaps(b *testing.B) {
+	benchmarkSummarize(b, MapCovers, DefaultOptions)
+}
+
+func BenchmarkSummarizeBitmaps(b *testing.B) {
+	benchmarkSummarize(b, BitmapCovers, DefaultOptions)
+}
+
+func BenchmarkSummarizeParallel(b *testing.B) {
+	options := DefaultOptions
+	options.Workers = runtime.NumCPU()
+	benchmarkSummarize(b, BitmapCovers, options)
+}
+
+func benchmarkIndex(b *testing.B, representation CoverRepresentation) {
+	var before, after runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		relation := makeRandomRelation(100000, representation)
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc)), "index-bytes")
+		runtime.KeepAlive(relation)
+	}
+}
+
+func BenchmarkIndexMaps(b *testing.B) {
+	benchmarkIndex(b, MapCovers)
+}
+
+func BenchmarkIndexBitmaps(b *testing.B) {
+	benchmarkIndex(b, BitmapCovers)
+}
+
+func TestParallel(t *testing.T) {
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		relation := makeRandomRelation(2000, representation)
+		relation.AddNegations(0.01)
+
+		options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true, Alternatives: 3}
+		sequential := fmt.Sprintf("%v", relation.SummarizeWithOptions(10, options))
+		relation.Reset()
+
+		options.Workers = 4
+		parallel := fmt.Sprintf("%v", relation.SummarizeWithOptions(10, options))
+		relation.Reset()
+
+		if sequential != parallel {
+			t.Error("Parallel search should give the same summary and alternatives", sequential, parallel)
+		}
+	}
+
+	// the alternatives depend on which cells are evaluated, small relations with many tied cells show the difference
+	for seed := int64(0); seed < 30; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		rows := []string{"single,single,single,set", "a,b,c,d"}
+		for i := 0; i < 60; i++ {
+			rows = append(rows, fmt.Sprintf("%d,%d,%d,%d %d", random.Intn(4), random.Intn(6), random.Intn(10), random.Intn(5), random.Intn(5)))
+		}
+		relation, err := NewIndexFromString(strings.Join(rows, "\n"), MakeEqualWeightAssessor())
+		if err != nil {
+			t.Fatal(err)
+		}
+		relation.AddNegations(0.2)
+
+		options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true, Alternatives: 3}
+		sequential := fmt.Sprintf("%v", relation.SummarizeWithOptions(5, options))
+		relation.Reset()
+
+		options.Workers = 4
+		parallel := fmt.Sprintf("%v", relation.SummarizeWithOptions(5, options))
+		relation.Reset()
+
+		if sequential != parallel {
+			t.Error("Parallel search should give the same alternatives", seed, sequential, parallel)
+		}
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single\nv,w\na,x\na,y\nb,y\nc,z", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rankedCells := makeRankedCells(*relation, DefaultOptions)
+	candidates := newCandidates(rankedCells, true)
+
+	var seed *RankedCell
+	for _, cell := range rankedCells {
+		if cell.cell.value() == "a" {
+			seed = cell
+		}
+	}
+
+	var values []string
+	for _, cell := range *candidates.start(seed, DefaultOptions) {
+		values = append(values, cell.cell.value())
+	}
+	if len(values) != 2 || values[0] == values[1] || (values[0] != "x" && values[0] != "y") || (values[1] != "x" && values[1] != "y") {
+		t.Error("Only cells that share tuples with the seed should be candidates", values)
+	}
+
+	options := DefaultOptions
+	options.MaxDisjuncts = 2
+	if n := len(*candidates.start(seed, options)); n != 4 {
+		t.Error("Other values of the attribute should be candidates for disjunctions", n)
+	}
+}
+
+func TestValueJSON(t *testing.T) {
+	value := Value{single, "venue", "SIGMOD", false, []string{"VLDB"}}
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"attribute":"venue","type":"single","value":"SIGMOD","disjuncts":["VLDB"]}` {
+		t.Error("Wrong JSON", string(data))
+	}
+
+	var decoded Value
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(decoded) != fmt.Sprint(value) {
+		t.Error("Value should survive a round trip", decoded)
+	}
+}
+
+func TestSummarizeContext(t *testing.T) {
+	relation := makeRandomRelation(2000, MapCovers)
+	options := Options{Deterministic: true}
+
+	expected := relation.SummarizeWithOptions(5, options)
+	relation.Reset()
+	result, err := relation.SummarizeContext(context.Background(), 5, options)
+	relation.Reset()
+	if err != nil || fmt.Sprint(result) != fmt.Sprint(expected) {
+		t.Error("Summaries should be the same", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err = relation.SummarizeContext(ctx, 5, options)
+	if err != context.Canceled || len(result.Summary) != 0 {
+		t.Error("Canceled summary should stop", err, result)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single,set\nvenue,year,tags\nSIGMOD,2015,db ml\nSIGMOD,2014,db\nVLDB,2015,db\nICDE,2015,ml\nSIGMOD,2013,db\nVLDB,2014,ml", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	year := Value{single, "year", "2015", false, nil}
+	tags := Value{set, "tags", "db", false, nil}
+
+	for _, options := range []Options{{Pinned: []Value{year}}, {Pinned: []Value{year}, Deterministic: true, MaxDisjuncts: 2}, {Pinned: []Value{year, tags}, Workers: 4}} {
+		result := relation.SummarizeWithOptions(5, options)
+		relation.Reset()
+		if len(result.Summary) == 0 {
+			t.Fatal("Pinned values should give formulas", options)
+		}
+		for _, formula := range result.Summary {
+			for _, pinned := range options.Pinned {
+				found := 0
+				for _, value := range formula {
+					if fmt.Sprint(value) == fmt.Sprint(pinned) {
+						found++
+					}
+				}
+				if found != 1 {
+					t.Error("Every formula should have the pinned value once", formula, pinned)
+				}
+			}
+		}
+		for _, cover := range result.FormulaCover {
+			if cover <= 0 {
+				t.Error("Formulas should cover something", result)
+			}
+		}
+	}
+
+	result := relation.SummarizeWithOptions(5, Options{Pinned: []Value{{single, "year", "2000", false, nil}}})
+	if len(result.Summary) != 0 {
+		t.Error("Missing pinned value should give an empty summary", result)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,single,set\nvenue,year,tags\nSIGMOD,2015,db ml\nSIGMOD,2015,db\nSIGMOD,2015,db\nSIGMOD,2015,ml\nVLDB,2014,ml\nVLDB,2013,db", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relation.AddNegations(0.3)
+
+	// without requirements the last formula is only venue != VLDB
+	options := Options{MaxNegations: 1, Deterministic: true}
+	summary := relation.SummarizeWithOptions(3, options)
+	relation.Reset()
+	if fmt.Sprint(summary.Summary[2]) != "[{0 venue VLDB true []}]" {
+		t.Error("Wrong last formula", summary.Summary)
+	}
+
+	options.Required = []string{"tags", "year"}
+	summary = relation.SummarizeWithOptions(3, options)
+	relation.Reset()
+	if len(summary.Summary) == 0 {
+		t.Fatal("Required attributes should give formulas")
+	}
+	for _, formula := range summary.Summary {
+		for _, name := range options.Required {
+			has := false
+			for _, value := range formula {
+				has = has || (value.attributeName == name && !value.negated)
+			}
+			if !has {
+				t.Error("Formula should have a value of", name, formula)
+			}
+		}
+	}
+
+	// pins and requirements combine
+	options.Pinned = []Value{{single, "venue", "VLDB", false, nil}}
+	summary = relation.SummarizeWithOptions(3, options)
+	relation.Reset()
+	if len(summary.Summary) != 2 {
+		t.Error("VLDB should have a formula for every year", summary.Summary)
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	assessor := MakeEqualWeightAssessor()
+	relation, err := NewIndexFromString("single,set\nvenue,tags\nSIGMOD,db ml\nSIGMOD,db ml\nSIGMOD,db\nVLDB,ml\nVLDB,ml", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strict := relation.SummarizeWithOptions(3, Options{Deterministic: true})
+	relation.Reset()
+	overlapping := relation.SummarizeWithOptions(3, Options{Deterministic: true, Overlap: 0.5})
+	relation.Reset()
+
+	// the VLDB tuples were covered by tags = ml, which only counts in the third formula if covers overlap
+	if fmt.Sprint(strict) != "{[[{1 tags ml false []}] [{0 venue SIGMOD false []} {1 tags db false []}] [{0 venue VLDB false []}]] [4 6 2] 12 []}" {
+		t.Error("Wrong strict summary", strict)
+	}
+	if fmt.Sprint(overlapping) != "{[[{1 tags ml false []}] [{0 venue SIGMOD false []} {1 tags db false []}] [{0 venue VLDB false []} {1 tags ml false []}]] [4 6 3] 13 []}" {
+		t.Error("Wrong overlapping summary", overlapping)
+	}
+
+	// representations, workers and resets agree
+	var results []string
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		relation := makeRandomRelation(2000, representation)
+		relation.AddNegations(0.01)
+		options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true, Overlap: 0.3}
+		for _, workers := range []int{1, 4} {
+			options.Workers = workers
+			results = append(results, fmt.Sprintf("%v", relation.SummarizeWithOptions(10, options)))
+			relation.Reset()
+		}
+	}
+	for _, result := range results[1:] {
+		if result != results[0] {
+			t.Error("Overlapping summaries should not depend on the representation or workers", result, results[0])
+		}
+	}
+
+	// a formula is not repeated even if it is still the best
+	single, _ := NewIndexFromString("single\nvenue\nSIGMOD\nSIGMOD", assessor)
+	if result := single.SummarizeWithOptions(3, Options{Overlap: 0.9}); len(result.Summary) != 1 {
+		t.Error("Formulas should not repeat", result)
+	}
+
+	// the overlap is not kept in the index, covered tuples count nothing unless a call overlaps
+	single.Reset()
+	single.SummarizeWithOptions(1, Options{Overlap: 0.5})
+	if formula, _ := single.formula([]Value{{0, "venue", "SIGMOD", false, nil}}, 0); formula.cover != 0 {
+		t.Error("Covered tuples should not count without overlap", formula.cover)
+	}
+	if formula, _ := single.formula([]Value{{0, "venue", "SIGMOD", false, nil}}, 0.5); formula.cover != 1 {
+		t.Error("Covered tuples should count with overlap", formula.cover)
+	}
+	single.Reset()
+
+	for _, overlap := range []float64{-0.1, 1} {
+		options := Options{Overlap: overlap}
+		if result, err := single.SummarizeContext(context.Background(), 1, options); err == nil || len(result.Summary) != 0 {
+			t.Error("Should fail for an invalid overlap", overlap, result)
+		}
+		if result := single.Resummarize(SummaryResult{}, 1, options, 1); len(result.Summary) != 0 {
+			t.Error("Should not resummarize with an invalid overlap", overlap, result)
+		}
+	}
+
+	// formulas with the same cells in another order are the same formula, and seen formulas do not end a pinned summary
+	multiple, err := NewIndexFromString("single,single,single\na,b,c\nx,p,u\nx,p,u\nx,p,u\nx,p,v\nx,q,v\ny,q,w", assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned := []Value{MakeValue("a", "x", false)}
+	for _, options := range []Options{{Deterministic: true, Overlap: 0.9}, {Deterministic: true, Overlap: 0.9, Pinned: pinned}, {Overlap: 0.9, Required: []string{"c"}}} {
+		result := multiple.SummarizeWithOptions(6, options)
+		multiple.Reset()
+		keys := make(map[string]bool)
+		for _, values := range result.Summary {
+			if keys[formulaKey(values)] {
+				t.Error("Formulas should not repeat in another order", result.Summary)
+			}
+			keys[formulaKey(values)] = true
+		}
+		if len(result.Summary) < 4 {
+			t.Error("Seen formulas should not end the summary", options, result.Summary)
+		}
+	}
+}
@@ -7,6 +7,7 @@ const (
 	single Type = iota
 	set
 	hierarchy
+	timestamp
 )
 
 func (t Type) String() string {
@@ -17,7 +18,14 @@ func (t Type) String() string {
 		return "set"
 	case hierarchy:
 		return "hierarchy"
+	case timestamp:
+		return "time"
 	default:
 		return "unknown"
 	}
 }
+
+// hierarchical is true for types whose values are indexed as prefix paths
+func (t Type) hierarchical() bool {
+	return t == hierarchy || t == timestamp
+}
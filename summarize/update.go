@@ -0,0 +1,212 @@
+package summarize
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AddTuple adds a tuple with raw values like a row of NewIndexFromString, the tuple is ranked last and its id is returned
+// the weights of all tuples are recomputed if the weights of the assessor depend on the rank
+func (relation *RelationIndex) AddTuple(values []string, assessor Assessor) (int, error) {
+	tuples, err := relation.AddTuples([][]string{values}, assessor)
+	if err != nil {
+		return -1, err
+	}
+	return tuples[0], nil
+}
+
+// AddTuples adds tuples like AddTuple but recomputes the weights only once, their ids are returned in order
+// nothing is added if a tuple cannot be added
+func (relation *RelationIndex) AddTuples(rows [][]string, assessor Assessor) ([]int, error) {
+	first := relation.numTuples
+	assessor.NumTuples = first + len(rows)
+
+	var tuples []int
+	for _, values := range rows {
+		tuple := relation.numTuples
+		if err := relation.addRow(values, tuple, assessor); err != nil {
+			// remove what was added before the error
+			var added []int
+			for t := first; t <= tuple; t++ {
+				added = append(added, t)
+			}
+			relation.removeTuples(added, tuple+1)
+			relation.numTuples = first
+			return nil, err
+		}
+		relation.numTuples++
+		relation.addNegations(values, tuple, assessor)
+		tuples = append(tuples, tuple)
+	}
+
+	relation.reweight(assessor)
+	return tuples, nil
+}
+
+// addNegations adds a tuple to the negated cells of the values that it does not have
+func (relation *RelationIndex) addNegations(values []string, tuple int, assessor Assessor) {
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		if attr.attributeType != single {
+			continue
+		}
+		value := strings.TrimSpace(values[ia])
+		if len(value) == 0 {
+			continue
+		}
+		id, _ := attr.values.lookup(value)
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+			if cell.negated && cell.id != id {
+				cell.add(tuple, assessor.Weight(attr, tuple))
+			}
+		}
+	}
+}
+
+// RemoveTuple removes a tuple, the tuples after it move up by one rank and their ids decrease by one
+// cells that cover no tuples anymore are removed, the weights of all tuples are recomputed if the weights of the assessor depend on the rank
+func (relation *RelationIndex) RemoveTuple(tuple int, assessor Assessor) error {
+	return relation.RemoveTuples([]int{tuple}, assessor)
+}
+
+// RemoveTuples removes tuples like RemoveTuple but shifts the other tuples and recomputes the weights only once
+// the ids of the remaining tuples decrease by the number of removed tuples before them, values that no cell has anymore leave the dictionaries
+func (relation *RelationIndex) RemoveTuples(tuples []int, assessor Assessor) error {
+	for _, tuple := range tuples {
+		if tuple < 0 || tuple >= relation.numTuples {
+			err := fmt.Sprintf("Tuple %d is not in the index. The index has %d tuples.", tuple, relation.numTuples)
+			return errors.New(err)
+		}
+	}
+
+	removed := relation.removeTuples(tuples, relation.numTuples)
+	relation.numTuples -= removed
+	relation.reweight(assessor)
+	return nil
+}
+
+// removeTuples removes tuples from all cells of an index with numTuples tuples in one pass and returns how many were removed
+func (relation *RelationIndex) removeTuples(tuples []int, numTuples int) int {
+	// the new id of every tuple, -1 if it is removed
+	moved := make([]int, numTuples)
+	for _, tuple := range tuples {
+		moved[tuple] = -1
+	}
+	removed := 0
+	for tuple := range moved {
+		if moved[tuple] < 0 {
+			removed++
+		} else {
+			moved[tuple] = tuple - removed
+		}
+	}
+	if removed == 0 {
+		return 0
+	}
+
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+
+		if len(attr.weights) > 0 {
+			weights := attr.weights[:0]
+			for tuple, weight := range attr.weights {
+				if tuple >= numTuples || moved[tuple] >= 0 {
+					weights = append(weights, weight)
+				}
+			}
+			attr.weights = weights
+		}
+
+		cells := attr.cells[:0]
+		for ic := range attr.cells {
+			cell := attr.cells[ic]
+			cell.moveTuples(moved)
+			if cell.size() > 0 {
+				cells = append(cells, cell)
+			}
+		}
+		attr.cells = cells
+		attr.compactValues()
+	}
+	return removed
+}
+
+// compactValues drops the values that no cell has from the dictionary and finds the positions of the cells again
+func (attr *Attribute) compactValues() {
+	used := make([]bool, attr.values.len())
+	for _, cell := range attr.cells {
+		used[cell.id] = true
+	}
+	ids := attr.values.compact(used)
+	for ic := range attr.cells {
+		attr.cells[ic].id = ids[attr.cells[ic].id]
+	}
+
+	// cells moved so their positions have to be found again
+	cells := attr.cells
+	attr.cells = cells[:0]
+	attr.valueCells = nil
+	attr.negatedCells = nil
+	for _, cell := range cells {
+		attr.appendCell(cell)
+	}
+}
+
+// moveTuples gives the tuples of the cell their new ids, tuples with a negative new id are removed
+func (cell *Cell) moveTuples(moved []int) {
+	cell.tuples = nil
+
+	if cell.bitmap != nil {
+		move := func(b *Bitmap) Bitmap {
+			var shifted Bitmap
+			it := b.Iterator()
+			for t, ok := it.Next(); ok; t, ok = it.Next() {
+				if moved[t] >= 0 {
+					shifted.Add(moved[t])
+				}
+			}
+			return shifted
+		}
+		var counts map[int]int
+		if cell.bitmap.counts != nil {
+			counts = make(map[int]int, len(cell.bitmap.counts))
+		}
+		for t, count := range cell.bitmap.counts {
+			if moved[t] >= 0 {
+				counts[moved[t]] = count
+			}
+		}
+		cell.bitmap = &bitmapCover{move(&cell.bitmap.tuples), move(&cell.bitmap.covered), nil, counts}
+		return
+	}
+
+	covers := make(TupleCover, len(cell.covers))
+	for t, cover := range cell.covers {
+		if moved[t] >= 0 {
+			covers[moved[t]] = cover
+		}
+	}
+	cell.covers = covers
+}
+
+// reweight recomputes the weights of all tuples if they depend on the rank and the number of tuples
+func (relation *RelationIndex) reweight(assessor Assessor) {
+	if assessor.function != Exponential && assessor.function != Linear {
+		return
+	}
+	assessor.NumTuples = relation.numTuples
+
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		for tuple := range attr.weights {
+			attr.weights[tuple] = assessor.Weight(attr, tuple)
+		}
+		for ic := range attr.cells {
+			for tuple, cover := range attr.cells[ic].covers {
+				cover.weight = assessor.Weight(attr, tuple)
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package summarize
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// describeCells describes the cells of an index independently of their order
+func describeCells(relation *RelationIndex) string {
+	var cells []string
+	for ia := range relation.attrs {
+		attr := &relation.attrs[ia]
+		for ic := range attr.cells {
+			cell := &attr.cells[ic]
+			var covers []string
+			for _, tuple := range cell.sortedTuples() {
+				weight, _, _ := cell.lookup(tuple)
+				covers = append(covers, fmt.Sprintf("%d:%.6f", tuple, weight))
+			}
+			cells = append(cells, fmt.Sprintf("%s %s %t %v", attr.attributeName, cell.value(), cell.negated, covers))
+			if attr.find(cell.value()) < 0 {
+				cells = append(cells, "missing "+cell.value())
+			}
+		}
+	}
+	sort.Strings(cells)
+	return strings.Join(cells, "\n")
+}
+
+func TestAddTuple(t *testing.T) {
+	lines := strings.Split(partitionDescription, "\n")
+
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})
+		expected, err := NewIndexFromString(partitionDescription, assessor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected.SetCoverRepresentation(representation)
+		expected.AddNegations(0.3)
+
+		relation, err := NewIndexFromString(strings.Join(lines[:8], "\n"), assessor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		relation.SetCoverRepresentation(representation)
+		relation.AddNegations(0.3)
+		for i, line := range lines[8:] {
+			tuple, err := relation.AddTuple(strings.Split(line, ","), assessor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tuple != 6+i {
+				t.Error("Wrong tuple id", tuple)
+			}
+		}
+
+		if relation.numTuples != expected.numTuples {
+			t.Error("Wrong number of tuples", relation.numTuples)
+		}
+		if describeCells(relation) != describeCells(expected) {
+			t.Error("Adding tuples should give the same index", describeCells(relation), describeCells(expected))
+		}
+
+		options := Options{MaxNegations: 1, MaxDisjuncts: 2, Deterministic: true}
+		if fmt.Sprintf("%v", relation.SummarizeWithOptions(3, options)) != fmt.Sprintf("%v", expected.SummarizeWithOptions(3, options)) {
+			t.Error("Adding tuples should give the same summary")
+		}
+	}
+}
+
+func TestAddTupleAfterSummarize(t *testing.T) {
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		assessor := MakeEqualWeightAssessor()
+		relation, err := NewIndexFromString("single,set\nvenue,tags\nSIGMOD,db\nSIGMOD,db ml\nVLDB,ml", assessor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		relation.SetCoverRepresentation(representation)
+
+		// a deterministic summary sorts the tuples of the cells
+		relation.SummarizeWithOptions(2, Options{Deterministic: true})
+		relation.Reset()
+
+		tuple, err := relation.AddTuple([]string{"SIGMOD", "ml"}, assessor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigmod := []Value{{single, "venue", "SIGMOD", false, nil}}
+		if members := relation.Members(sigmod); fmt.Sprint(members) != fmt.Sprint([]int{0, 1, tuple}) {
+			t.Error("Wrong members after adding a tuple", members)
+		}
+
+		var buffer bytes.Buffer
+		if _, err := relation.WriteTo(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := ReadIndex(&buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if describeCells(loaded) != describeCells(relation) {
+			t.Error("The snapshot should have the added tuple", describeCells(loaded), describeCells(relation))
+		}
+		if members := loaded.Members(sigmod); len(members) != 3 {
+			t.Error("Wrong members in the snapshot", members)
+		}
+	}
+}
+
+func TestAddTupleErrors(t *testing.T) {
+	assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})
+	relation, err := NewIndexFromString(partitionDescription, assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := describeCells(relation)
+
+	if _, err := relation.AddTuple([]string{"a", "b"}, assessor); err == nil {
+		t.Error("Should fail for the wrong number of values")
+	}
+	if _, err := relation.AddTuple([]string{"new", "b", "c", "a b", "not a time"}, assessor); err == nil {
+		t.Error("Should fail for an invalid time")
+	}
+	if relation.numTuples != 9 || describeCells(relation) != before {
+		t.Error("Failed tuples should not change the index", describeCells(relation))
+	}
+	if relation.RemoveTuple(9, assessor) == nil || relation.RemoveTuple(-1, assessor) == nil {
+		t.Error("Should fail for tuples that are not in the index")
+	}
+}
+
+func TestRemoveTuple(t *testing.T) {
+	lines := strings.Split(partitionDescription, "\n")
+
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		for _, removed := range []int{0, 3, 8} {
+			assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})
+			remaining := append(append([]string{}, lines[:2+removed]...), lines[3+removed:]...)
+			expected, err := NewIndexFromString(strings.Join(remaining, "\n"), assessor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected.SetCoverRepresentation(representation)
+
+			relation, err := NewIndexFromString(partitionDescription, assessor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			relation.SetCoverRepresentation(representation)
+			if err := relation.RemoveTuple(removed, assessor); err != nil {
+				t.Fatal(err)
+			}
+
+			if relation.numTuples != 8 {
+				t.Error("Wrong number of tuples", relation.numTuples)
+			}
+			if describeCells(relation) != describeCells(expected) {
+				t.Error("Removing a tuple should give the same index", removed, describeCells(relation), describeCells(expected))
+			}
+		}
+	}
+}
+
+func TestRemoveTuples(t *testing.T) {
+	lines := strings.Split(partitionDescription, "\n")
+
+	for _, representation := range []CoverRepresentation{MapCovers, BitmapCovers} {
+		assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})
+		remaining := append(append([]string{}, lines[:2]...), lines[3:5]...)
+		remaining = append(remaining, lines[6:10]...)
+		expected, err := NewIndexFromString(strings.Join(remaining, "\n"), assessor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected.SetCoverRepresentation(representation)
+
+		relation, err := NewIndexFromString(partitionDescription, assessor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		relation.SetCoverRepresentation(representation)
+		if err := relation.RemoveTuples([]int{8, 0, 3, 3}, assessor); err != nil {
+			t.Fatal(err)
+		}
+
+		if relation.numTuples != 6 {
+			t.Error("Wrong number of tuples", relation.numTuples)
+		}
+		if describeCells(relation) != describeCells(expected) {
+			t.Error("Removing tuples should give the same index", describeCells(relation), describeCells(expected))
+		}
+		for ia := range relation.attrs {
+			if relation.attrs[ia].values.len() != expected.attrs[ia].values.len() {
+				t.Error("Removed values should leave the dictionary", relation.attrs[ia].attributeName, relation.attrs[ia].values.len(), expected.attrs[ia].values.len())
+			}
+		}
+	}
+
+	// values of a finalized index leave the dictionary as well
+	assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})
+	relation, err := NewIndexFromString(partitionDescription, assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relation.Finalize()
+	value := relation.attrs[0].cells[0].value()
+	if err := relation.RemoveTuples(relation.Members([]Value{{single, relation.attrs[0].attributeName, value, false, nil}}), assessor); err != nil {
+		t.Fatal(err)
+	}
+	if _, has := relation.attrs[0].values.lookup(value); has || relation.attrs[0].values.ids != nil {
+		t.Error("The removed value should leave the finalized dictionary", value)
+	}
+	if relation.RemoveTuples([]int{0, relation.numTuples}, assessor) == nil {
+		t.Error("Should fail for tuples that are not in the index")
+	}
+}
+
+func TestAddTuples(t *testing.T) {
+	lines := strings.Split(partitionDescription, "\n")
+	assessor := MakeExponentialAssessor([]float64{0.3, 0.7, 0.1, 0.9, 0.5})
+	expected, err := NewIndexFromString(partitionDescription, assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	relation, err := NewIndexFromString(strings.Join(lines[:8], "\n"), assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, values := describeCells(relation), relation.attrs[0].values.len()
+	var rows [][]string
+	for _, line := range lines[8:] {
+		rows = append(rows, strings.Split(line, ","))
+	}
+
+	// nothing is added if a tuple fails
+	failed := append(append([][]string{}, rows...), []string{"new", "b", "c", "a b", "not a time"})
+	if _, err := relation.AddTuples(failed, assessor); err == nil {
+		t.Error("Should fail for an invalid time")
+	}
+	if relation.numTuples != 6 || describeCells(relation) != before || relation.attrs[0].values.len() != values {
+		t.Error("Failed tuples should not change the index", describeCells(relation))
+	}
+
+	tuples, err := relation.AddTuples(rows, assessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(tuples) != "[6 7 8]" {
+		t.Error("Wrong tuple ids", tuples)
+	}
+	if describeCells(relation) != describeCells(expected) {
+		t.Error("Adding tuples should give the same index", describeCells(relation), describeCells(expected))
+	}
+}